@@ -2,33 +2,43 @@ package ast
 
 import "morklerork/symbols"
 
+// Every Expression and Command records the Position of the Symbol it was
+// parsed from, so the executor can report errors against the source file
+
 type Expression interface{}
 
 type StringLiteral struct {
+	Pos   symbols.Position
 	Value string
 }
 
 type IntLiteral struct {
+	Pos   symbols.Position
 	Value int
 }
 
 type BooleanLiteral struct {
+	Pos   symbols.Position
 	Value bool
 }
 
 type VariableName struct {
+	Pos  symbols.Position
 	Name string
 }
 
 type ProgramName struct {
+	Pos  symbols.Position
 	Name string
 }
 
 type HeapAccess struct {
+	Pos             symbols.Position
 	IndexExpression Expression
 }
 
 type BinaryOperator struct {
+	Pos symbols.Position
 	// There is no need to re-state the BinaryOperatorType's just re-use the symbols
 	BinaryOperatorType symbols.BinaryOperatorType
 	Lhs                Expression
@@ -38,40 +48,65 @@ type BinaryOperator struct {
 type Command interface{}
 
 type Log struct {
+	Pos    symbols.Position
 	Indent int
 	Expr   Expression
 }
 
 type Read struct {
+	Pos    symbols.Position
 	Indent int
 	Target Expression
 }
 
 type New struct {
+	Pos          symbols.Position
 	Indent       int
 	VariableName string
 	Expr         Expression
 }
 
 type Assign struct {
+	Pos    symbols.Position
 	Indent int
 	Target Expression
 	Expr   Expression
 }
 
+// If holds any elif and else commands that follow it at the same indent,
+// they are only parsed as commands of their own so ParseBlock can attach them here
 type If struct {
+	Pos      symbols.Position
+	Indent   int
+	Cond     Expression
+	Commands []Command
+	ElseIfs  []ElseIf
+	Else     Else
+	HasElse  bool
+}
+
+type ElseIf struct {
+	Pos      symbols.Position
 	Indent   int
 	Cond     Expression
 	Commands []Command
 }
 
+type Else struct {
+	Pos      symbols.Position
+	Indent   int
+	Commands []Command
+}
+
 type While struct {
+	Pos      symbols.Position
 	Indent   int
 	Cond     Expression
 	Commands []Command
 }
 
 type Program struct {
+	Pos        symbols.Position
 	Indent     int
 	Name       ProgramName
 	Parameters []VariableName
@@ -79,6 +114,7 @@ type Program struct {
 }
 
 type Call struct {
+	Pos             symbols.Position
 	Indent          int
 	Name            ProgramName
 	Expressions     []Expression
@@ -87,8 +123,89 @@ type Call struct {
 }
 
 type Return struct {
+	Pos           symbols.Position
 	Indent        int
 	Name          ProgramName
 	Expression    Expression
 	HasExpression bool
 }
+
+type Break struct {
+	Pos    symbols.Position
+	Indent int
+}
+
+type Continue struct {
+	Pos    symbols.Position
+	Indent int
+}
+
+// Import is handled by the loader before a program is executed,
+// Path is relative to the importing file, or the name of a stdlib module
+type Import struct {
+	Pos    symbols.Position
+	Indent int
+	Path   string
+}
+
+// Assert stops the program with an error if Cond is false, Message is the
+// value of the error if HasMessage is set
+type Assert struct {
+	Pos        symbols.Position
+	Indent     int
+	Cond       Expression
+	Message    Expression
+	HasMessage bool
+}
+
+// PositionOf finds the Position of any Expression or Command, or the zero
+// Position if the node is not one of the types above
+func PositionOf(node interface{}) symbols.Position {
+	switch node := node.(type) {
+	case StringLiteral:
+		return node.Pos
+	case IntLiteral:
+		return node.Pos
+	case BooleanLiteral:
+		return node.Pos
+	case VariableName:
+		return node.Pos
+	case ProgramName:
+		return node.Pos
+	case HeapAccess:
+		return node.Pos
+	case BinaryOperator:
+		return node.Pos
+	case Log:
+		return node.Pos
+	case Read:
+		return node.Pos
+	case New:
+		return node.Pos
+	case Assign:
+		return node.Pos
+	case If:
+		return node.Pos
+	case ElseIf:
+		return node.Pos
+	case Else:
+		return node.Pos
+	case While:
+		return node.Pos
+	case Program:
+		return node.Pos
+	case Call:
+		return node.Pos
+	case Return:
+		return node.Pos
+	case Break:
+		return node.Pos
+	case Continue:
+		return node.Pos
+	case Assert:
+		return node.Pos
+	case Import:
+		return node.Pos
+	}
+	return symbols.Position{}
+}
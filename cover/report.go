@@ -0,0 +1,151 @@
+package cover
+
+import (
+	"fmt"
+	"io"
+	"morklerork/executor"
+	"morklerork/stdlib"
+	"os"
+	"strings"
+)
+
+// file is the coverage of the commands and conditions in one file
+type file struct {
+	name     string
+	commands []executor.CommandCount
+	branches []executor.BranchCount
+}
+
+// ranCommands is how many commands in the file ran at least once
+func (file file) ranCommands() int {
+	ran := 0
+	for _, command := range file.commands {
+		if command.Count > 0 {
+			ran++
+		}
+	}
+	return ran
+}
+
+// takenBranches is how many ways conditions went, each condition can go two ways
+func (file file) takenBranches() int {
+	taken := 0
+	for _, branch := range file.branches {
+		if branch.True > 0 {
+			taken++
+		}
+		if branch.False > 0 {
+			taken++
+		}
+	}
+	return taken
+}
+
+func (file file) summary() string {
+	text := fmt.Sprintf("%s: %d of %d commands ran (%s)", file.name, file.ranCommands(), len(file.commands), percent(file.ranCommands(), len(file.commands)))
+	if len(file.branches) == 0 {
+		return text + ", no branches"
+	}
+	return text + fmt.Sprintf(", %d of %d branches taken (%s)", file.takenBranches(), 2*len(file.branches), percent(file.takenBranches(), 2*len(file.branches)))
+}
+
+func percent(part int, whole int) string {
+	if whole == 0 {
+		return "100.0%"
+	}
+	return fmt.Sprintf("%.1f%%", 100*float64(part)/float64(whole))
+}
+
+// files splits coverage up by the file each command is in, in order of file name
+func files(coverage *executor.Coverage) []file {
+	files := make([]file, 0)
+	byName := make(map[string]int)
+	fileOf := func(name string) *file {
+		if i, ok := byName[name]; ok {
+			return &files[i]
+		}
+		byName[name] = len(files)
+		files = append(files, file{name: name})
+		return &files[len(files)-1]
+	}
+	for _, command := range coverage.Commands() {
+		file := fileOf(command.Pos.File)
+		file.commands = append(file.commands, command)
+	}
+	for _, branch := range coverage.Branches() {
+		file := fileOf(branch.Pos.File)
+		file.branches = append(file.branches, branch)
+	}
+	return files
+}
+
+// Summary writes how much of each file ran, one line per file, such as
+// `stdlib/heap.mr: 90 of 104 commands ran (86.5%), 21 of 30 branches taken (70.0%)`.
+// Each if, elif and while condition is two branches, one for true and one for false
+func Summary(coverage *executor.Coverage, stdout io.Writer) {
+	for _, file := range files(coverage) {
+		fmt.Fprintln(stdout, "coverage: "+file.summary())
+	}
+}
+
+// WriteListing writes each file with how many times the command on every line
+// ran, in the style of gcov. Lines without a command are marked `-`, and
+// lines whose command never ran are marked `#####`. Under each if, elif and
+// while is how many times its condition was true and false, marked `#####`
+// if it never went one of the ways
+func WriteListing(coverage *executor.Coverage, stdout io.Writer) error {
+	for i, file := range files(coverage) {
+		if i > 0 {
+			fmt.Fprintln(stdout)
+		}
+		lines, err := sourceLines(file.name)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintln(stdout, file.summary())
+		counts := make(map[int]int)
+		for _, command := range file.commands {
+			if _, ok := counts[command.Pos.Line]; !ok {
+				counts[command.Pos.Line] = command.Count
+			}
+		}
+		branches := make(map[int][]executor.BranchCount)
+		for _, branch := range file.branches {
+			branches[branch.Pos.Line] = append(branches[branch.Pos.Line], branch)
+		}
+
+		for number, line := range lines {
+			number++
+			count, ok := counts[number]
+			switch {
+			case !ok:
+				fmt.Fprintf(stdout, "%9s:%5d:%s\n", "-", number, line)
+			case count == 0:
+				fmt.Fprintf(stdout, "%9s:%5d:%s\n", "#####", number, line)
+			default:
+				fmt.Fprintf(stdout, "%9d:%5d:%s\n", count, number, line)
+			}
+			for _, branch := range branches[number] {
+				mark := "branch"
+				if branch.True == 0 || branch.False == 0 {
+					mark = "#####"
+				}
+				fmt.Fprintf(stdout, "%9s:%5s: %s condition true %d times, false %d times\n", mark, "", branch.Kind, branch.True, branch.False)
+			}
+		}
+	}
+	return nil
+}
+
+// sourceLines reads the lines of a file, from the disk or the embedded stdlib
+func sourceLines(fileName string) ([]string, error) {
+	if libFile, isStdlib := stdlib.FileNamed(fileName); isStdlib {
+		return strings.Split(strings.TrimSuffix(libFile.Content, "\n"), "\n"), nil
+	}
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Split(strings.TrimSuffix(string(content), "\n"), "\n"), nil
+}
@@ -0,0 +1,108 @@
+package cover
+
+import (
+	"bytes"
+	"morklerork/executor"
+	"morklerork/loader"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const source = `new :i 0
+while :i < 3
+    if :i == 1
+        log 'one'
+    else
+        log 'other'
+    = :i :i + 1
+
+if :i == 0
+    log 'never'
+`
+
+func TestCoverage(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "program.mr")
+	if err := os.WriteFile(file, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	commands, err := loader.Load(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, engine := range []struct {
+		name       string
+		treeWalker bool
+	}{{"bytecode", false}, {"treewalker", true}} {
+		t.Run(engine.name, func(t *testing.T) {
+			coverage := executor.NewCoverage()
+			options := executor.Options{TreeWalker: engine.treeWalker, Coverage: coverage}
+			var output bytes.Buffer
+			interpreter := executor.NewInterpreter(strings.NewReader(""), &output, executor.DefaultHeapSize, options)
+			if err := interpreter.Execute(commands); err != nil {
+				t.Fatal(err)
+			}
+
+			lineCounts := make(map[int]int)
+			for _, command := range coverage.Commands() {
+				lineCounts[command.Pos.Line] = command.Count
+			}
+			expectedCounts := map[int]int{1: 1, 2: 1, 3: 3, 4: 1, 6: 2, 7: 3, 9: 1, 10: 0}
+			for line, expected := range expectedCounts {
+				if lineCounts[line] != expected {
+					t.Errorf("expected line %d to run %d times, got %d", line, expected, lineCounts[line])
+				}
+			}
+			if len(lineCounts) != len(expectedCounts) {
+				t.Errorf("expected commands on %d lines, got %v", len(expectedCounts), lineCounts)
+			}
+
+			branches := coverage.Branches()
+			expectedBranches := []executor.BranchCount{
+				{Kind: "While", True: 3, False: 1},
+				{Kind: "If", True: 1, False: 2},
+				{Kind: "If", True: 0, False: 1},
+			}
+			if len(branches) != len(expectedBranches) {
+				t.Fatalf("expected %d conditions, got %v", len(expectedBranches), branches)
+			}
+			for i, expected := range expectedBranches {
+				expected.Pos = branches[i].Pos
+				if branches[i] != expected {
+					t.Errorf("expected %v, got %v", expected, branches[i])
+				}
+			}
+
+			var listing bytes.Buffer
+			if err := WriteListing(coverage, &listing); err != nil {
+				t.Fatal(err)
+			}
+			expectedListing := file + `: 7 of 8 commands ran (87.5%), 5 of 6 branches taken (83.3%)
+        1:    1:new :i 0
+        1:    2:while :i < 3
+   branch:     : While condition true 3 times, false 1 times
+        3:    3:    if :i == 1
+   branch:     : If condition true 1 times, false 2 times
+        1:    4:        log 'one'
+        -:    5:    else
+        2:    6:        log 'other'
+        3:    7:    = :i :i + 1
+        -:    8:
+        1:    9:if :i == 0
+    #####:     : If condition true 0 times, false 1 times
+    #####:   10:    log 'never'
+`
+			if listing.String() != expectedListing {
+				t.Errorf("expected\n%s\ngot\n%s", expectedListing, listing.String())
+			}
+
+			var summary bytes.Buffer
+			Summary(coverage, &summary)
+			if summary.String() != "coverage: "+strings.SplitN(expectedListing, "\n", 2)[0]+"\n" {
+				t.Errorf("unexpected summary %q", summary.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,544 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"morklerork/ast"
+	"morklerork/debugger"
+	"morklerork/executor"
+	"morklerork/lexer"
+	"morklerork/loader"
+	"morklerork/parser"
+	"morklerork/stdlib"
+	"morklerork/symbols"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// threadID is the only thread, MorkleRork programs run on one
+const threadID = 1
+
+// errTerminated is returned from the hook to stop the program when the client disconnects
+var errTerminated = errors.New("terminated")
+
+type server struct {
+	input *bufio.Reader
+
+	writeMutex sync.Mutex
+	output     io.Writer
+	seq        int
+
+	heapSize    int
+	options     executor.Options
+	stepper     *debugger.Stepper
+	interpreter *executor.Interpreter
+	program     []ast.Command
+	launched    bool
+	configured  bool
+	started     bool
+
+	// the breakpoints the client has set, by source path and program name.
+	// Editors set them before launch, so they are kept until the Stepper is made
+	lineBreakpoints    map[string][]int
+	programBreakpoints []string
+
+	// stateMutex guards the paused step and everything looked up from it,
+	// the hook sets them on the program's goroutine
+	stateMutex sync.Mutex
+	paused     *executor.Step
+	// the variables of each scope sent since the program paused,
+	// a variablesReference is an index into this plus 1
+	variables [][]executor.Variable
+	// the stdlib files sent as sources, a sourceReference is an index into this plus 1
+	sources    []string
+	terminated bool
+
+	// resumed unblocks the paused program, false stops it
+	resumed chan bool
+}
+
+// Run serves the debug adapter protocol over stdin and stdout until the client
+// disconnects. The program is launched on the tree walker, with its output sent
+// to the client as output events. `read` has no input, the protocol has no stdin.
+// The Interpreter is made with heapSize and options, whose Hook is replaced by the server's
+func Run(stdin io.Reader, stdout io.Writer, heapSize int, options executor.Options) error {
+	server := &server{
+		input:           bufio.NewReader(stdin),
+		output:          stdout,
+		heapSize:        heapSize,
+		options:         options,
+		lineBreakpoints: make(map[string][]int),
+		resumed:         make(chan bool),
+	}
+
+	for {
+		message, err := readRequest(server.input)
+		if err == io.EOF {
+			server.terminate()
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !server.handle(message) {
+			return nil
+		}
+	}
+}
+
+func (server *server) send(message interface{}) {
+	server.writeMutex.Lock()
+	defer server.writeMutex.Unlock()
+	server.seq++
+	switch message := message.(type) {
+	case response:
+		message.Seq = server.seq
+		writeMessage(server.output, message)
+	case event:
+		message.Seq = server.seq
+		writeMessage(server.output, message)
+	}
+}
+
+func (server *server) respond(message request, body interface{}) {
+	server.send(response{Type: "response", RequestSeq: message.Seq, Success: true, Command: message.Command, Body: body})
+}
+
+func (server *server) respondWithError(message request, text string) {
+	server.send(response{Type: "response", RequestSeq: message.Seq, Success: false, Command: message.Command, Message: text})
+}
+
+func (server *server) sendEvent(name string, body interface{}) {
+	server.send(event{Type: "event", Event: name, Body: body})
+}
+
+// outputWriter is the program's stdout, sending everything it writes to the client
+type outputWriter struct {
+	server *server
+}
+
+func (writer outputWriter) Write(content []byte) (int, error) {
+	writer.server.sendEvent("output", map[string]interface{}{"category": "stdout", "output": string(content)})
+	return len(content), nil
+}
+
+// handle responds to one request, returning false once the client has disconnected
+func (server *server) handle(message request) bool {
+	switch message.Command {
+	case "initialize":
+		server.respond(message, map[string]interface{}{
+			"supportsConfigurationDoneRequest": true,
+			"supportsFunctionBreakpoints":      true,
+			"supportsEvaluateForHovers":        true,
+		})
+		server.sendEvent("initialized", nil)
+	case "launch":
+		server.launch(message)
+	case "setBreakpoints":
+		server.setBreakpoints(message)
+	case "setFunctionBreakpoints":
+		server.setFunctionBreakpoints(message)
+	case "setExceptionBreakpoints":
+		server.respond(message, map[string]interface{}{"breakpoints": []breakpoint{}})
+	case "configurationDone":
+		server.configured = true
+		server.respond(message, nil)
+		server.start()
+	case "threads":
+		server.respond(message, map[string]interface{}{"threads": []map[string]interface{}{{"id": threadID, "name": "main"}}})
+	case "stackTrace":
+		server.stackTrace(message)
+	case "scopes":
+		server.scopes(message)
+	case "variables":
+		server.sendVariables(message)
+	case "evaluate":
+		server.evaluate(message)
+	case "source":
+		server.source(message)
+	case "continue":
+		server.resume(message, debugger.Continue)
+	case "next":
+		server.resume(message, debugger.StepOver)
+	case "stepIn":
+		server.resume(message, debugger.StepInto)
+	case "stepOut":
+		server.resume(message, debugger.StepOut)
+	case "pause":
+		if server.stepper != nil {
+			server.stepper.Pause()
+		}
+		server.respond(message, nil)
+	case "disconnect", "terminate":
+		server.terminate()
+		server.respond(message, nil)
+		return message.Command != "disconnect"
+	default:
+		server.respondWithError(message, "morklerork does not support the "+message.Command+" request")
+	}
+	return true
+}
+
+func (server *server) launch(message request) {
+	var arguments struct {
+		Program     string `json:"program"`
+		StopOnEntry bool   `json:"stopOnEntry"`
+	}
+	if err := json.Unmarshal(message.Arguments, &arguments); err != nil || arguments.Program == "" {
+		server.respondWithError(message, "launch needs the program to debug")
+		return
+	}
+	program, err := loader.Load(arguments.Program)
+	if err != nil {
+		server.respondWithError(message, err.Error())
+		return
+	}
+
+	server.program = program
+	server.stepper = debugger.NewStepper(arguments.Program, arguments.StopOnEntry)
+	for path, lines := range server.lineBreakpoints {
+		server.setLineBreakpoints(path, lines)
+	}
+	server.setProgramBreakpoints(server.programBreakpoints)
+	options := server.options
+	options.Hook = server.beforeCommand
+	server.interpreter = executor.NewInterpreter(strings.NewReader(""), outputWriter{server: server}, server.heapSize, options)
+	server.launched = true
+	server.respond(message, nil)
+	server.start()
+}
+
+// start runs the program once it has been launched and every breakpoint has been set
+func (server *server) start() {
+	if !server.launched || !server.configured || server.started {
+		return
+	}
+	server.started = true
+
+	go func() {
+		exitCode := 0
+		err := server.interpreter.Execute(server.program)
+		if err != nil && err != errTerminated {
+			server.sendEvent("output", map[string]interface{}{"category": "stderr", "output": err.Error() + "\n"})
+			exitCode = 1
+		}
+		server.sendEvent("exited", map[string]interface{}{"exitCode": exitCode})
+		server.sendEvent("terminated", nil)
+	}()
+}
+
+// beforeCommand is the Interpreter's Hook, blocking the program while it is paused
+func (server *server) beforeCommand(step executor.Step) error {
+	server.stateMutex.Lock()
+	terminated := server.terminated
+	server.stateMutex.Unlock()
+	if terminated {
+		return errTerminated
+	}
+
+	reason := server.stepper.ShouldPause(step)
+	if reason == "" {
+		return nil
+	}
+
+	server.stateMutex.Lock()
+	if server.terminated {
+		server.stateMutex.Unlock()
+		return errTerminated
+	}
+	server.paused = &step
+	server.variables = nil
+	server.stateMutex.Unlock()
+	server.sendEvent("stopped", map[string]interface{}{"reason": reason, "threadId": threadID, "allThreadsStopped": true})
+
+	keepRunning := <-server.resumed
+	if !keepRunning {
+		return errTerminated
+	}
+	return nil
+}
+
+// pausedStep is the step the program is paused at, if it is paused
+func (server *server) pausedStep() (executor.Step, bool) {
+	server.stateMutex.Lock()
+	defer server.stateMutex.Unlock()
+	if server.paused == nil {
+		return executor.Step{}, false
+	}
+	return *server.paused, true
+}
+
+func (server *server) resume(message request, kind debugger.ResumeKind) {
+	step, ok := server.pausedStep()
+	if !ok {
+		server.respondWithError(message, "the program is not paused")
+		return
+	}
+	server.stepper.Resume(kind, step)
+	server.stateMutex.Lock()
+	server.paused = nil
+	server.stateMutex.Unlock()
+
+	if kind == debugger.Continue {
+		server.respond(message, map[string]interface{}{"allThreadsContinued": true})
+	} else {
+		server.respond(message, nil)
+	}
+	server.resumed <- true
+}
+
+// terminate stops the program before its next command, if it is running
+func (server *server) terminate() {
+	server.stateMutex.Lock()
+	server.terminated = true
+	isPaused := server.paused != nil
+	server.paused = nil
+	server.stateMutex.Unlock()
+	if isPaused {
+		server.resumed <- false
+	}
+}
+
+func (server *server) setBreakpoints(message request) {
+	var arguments struct {
+		Source      source             `json:"source"`
+		Breakpoints []sourceBreakpoint `json:"breakpoints"`
+	}
+	if err := json.Unmarshal(message.Arguments, &arguments); err != nil || arguments.Source.Path == "" {
+		server.respondWithError(message, "setBreakpoints needs the path of a source")
+		return
+	}
+
+	lines := make([]int, 0, len(arguments.Breakpoints))
+	breakpoints := make([]breakpoint, 0, len(arguments.Breakpoints))
+	for _, sourceBreakpoint := range arguments.Breakpoints {
+		lines = append(lines, sourceBreakpoint.Line)
+		breakpoints = append(breakpoints, breakpoint{Verified: true, Line: sourceBreakpoint.Line})
+	}
+	server.lineBreakpoints[arguments.Source.Path] = lines
+	if server.stepper != nil {
+		server.setLineBreakpoints(arguments.Source.Path, lines)
+	}
+	server.respond(message, map[string]interface{}{"breakpoints": breakpoints})
+}
+
+// setLineBreakpoints replaces the Stepper's breakpoints in a file
+func (server *server) setLineBreakpoints(path string, lines []int) {
+	server.stepper.ClearLineBreakpoints(path)
+	for _, line := range lines {
+		server.stepper.SetLineBreakpoint(path, line, true)
+	}
+}
+
+func (server *server) setFunctionBreakpoints(message request) {
+	var arguments struct {
+		Breakpoints []functionBreakpoint `json:"breakpoints"`
+	}
+	if err := json.Unmarshal(message.Arguments, &arguments); err != nil {
+		server.respondWithError(message, "setFunctionBreakpoints needs a list of breakpoints")
+		return
+	}
+
+	names := make([]string, 0, len(arguments.Breakpoints))
+	breakpoints := make([]breakpoint, 0, len(arguments.Breakpoints))
+	for _, functionBreakpoint := range arguments.Breakpoints {
+		// a program is only ever named with its $, but an editor will not know that
+		name := functionBreakpoint.Name
+		if !strings.HasPrefix(name, "$") {
+			name = "$" + name
+		}
+		names = append(names, name)
+		breakpoints = append(breakpoints, breakpoint{Verified: true})
+	}
+	server.programBreakpoints = names
+	if server.stepper != nil {
+		server.setProgramBreakpoints(names)
+	}
+	server.respond(message, map[string]interface{}{"breakpoints": breakpoints})
+}
+
+// setProgramBreakpoints replaces the Stepper's breakpoints on programs
+func (server *server) setProgramBreakpoints(names []string) {
+	server.stepper.ClearProgramBreakpoints()
+	for _, name := range names {
+		server.stepper.SetProgramBreakpoint(name, true)
+	}
+}
+
+// sourceOf describes a file for the client. Stdlib files are not on disk,
+// so the client asks for their content with a source request
+func (server *server) sourceOf(file string) source {
+	if _, isStdlib := stdlib.FileNamed(file); isStdlib {
+		for i, sent := range server.sources {
+			if sent == file {
+				return source{Name: file, SourceReference: i + 1}
+			}
+		}
+		server.sources = append(server.sources, file)
+		return source{Name: file, SourceReference: len(server.sources)}
+	}
+	absolute, err := filepath.Abs(file)
+	if err != nil {
+		absolute = file
+	}
+	return source{Name: filepath.Base(file), Path: absolute}
+}
+
+// stackTrace sends the frames innermost first, numbered from 1 since a frameId of 0 means none
+func (server *server) stackTrace(message request) {
+	step, ok := server.pausedStep()
+	if !ok {
+		server.respondWithError(message, "the program is not paused")
+		return
+	}
+
+	server.stateMutex.Lock()
+	defer server.stateMutex.Unlock()
+	callStack := step.CallStack()
+	frames := make([]stackFrame, 0, len(callStack)+1)
+	pos := ast.PositionOf(step.Command)
+	for frame := 0; frame <= len(callStack); frame++ {
+		name := "top level"
+		if frame < len(callStack) {
+			name = callStack[len(callStack)-1-frame].Program
+		}
+		frames = append(frames, stackFrame{ID: frame + 1, Name: name, Source: server.sourceOf(pos.File), Line: pos.Line, Column: pos.Column})
+		if frame < len(callStack) {
+			// the next frame out is paused at the call to this one
+			pos = callStack[len(callStack)-1-frame].Pos
+		}
+	}
+	server.respond(message, map[string]interface{}{"stackFrames": frames, "totalFrames": len(frames)})
+}
+
+// frameOf turns a frameId back into the frame counted by executor.Step
+func frameOf(step executor.Step, frameID int) (int, bool) {
+	frame := frameID - 1
+	return frame, frame >= 0 && frame <= step.Depth()
+}
+
+func (server *server) scopes(message request) {
+	var arguments struct {
+		FrameID int `json:"frameId"`
+	}
+	json.Unmarshal(message.Arguments, &arguments)
+	step, ok := server.pausedStep()
+	if !ok {
+		server.respondWithError(message, "the program is not paused")
+		return
+	}
+	frame, ok := frameOf(step, arguments.FrameID)
+	if !ok {
+		server.respondWithError(message, "there is no frame "+strconv.Itoa(arguments.FrameID))
+		return
+	}
+
+	server.stateMutex.Lock()
+	defer server.stateMutex.Unlock()
+	isTopLevel := frame == step.Depth()
+	blocks := step.Scopes(frame)
+	scopes := make([]scope, 0, len(blocks))
+	// innermost first, the way editors expect to show them
+	for i := len(blocks) - 1; i >= 0; i-- {
+		name := "Block " + strconv.Itoa(i)
+		if i == 0 && isTopLevel {
+			name = "Globals"
+		} else if i == 0 {
+			name = "Parameters"
+		}
+		server.variables = append(server.variables, blocks[i])
+		scopes = append(scopes, scope{Name: name, VariablesReference: len(server.variables)})
+	}
+	server.respond(message, map[string]interface{}{"scopes": scopes})
+}
+
+func typeName(result executor.ExpressionResult) string {
+	switch result.Type {
+	case executor.Int:
+		return "int"
+	case executor.Bool:
+		return "bool"
+	}
+	return "string"
+}
+
+func (server *server) sendVariables(message request) {
+	var arguments struct {
+		VariablesReference int `json:"variablesReference"`
+	}
+	json.Unmarshal(message.Arguments, &arguments)
+
+	server.stateMutex.Lock()
+	defer server.stateMutex.Unlock()
+	if arguments.VariablesReference < 1 || arguments.VariablesReference > len(server.variables) {
+		server.respondWithError(message, "there is no variablesReference "+strconv.Itoa(arguments.VariablesReference))
+		return
+	}
+	variables := make([]variable, 0)
+	for _, scopeVariable := range server.variables[arguments.VariablesReference-1] {
+		variables = append(variables, variable{Name: scopeVariable.Name, Value: scopeVariable.Value.Literal(), Type: typeName(scopeVariable.Value)})
+	}
+	server.respond(message, map[string]interface{}{"variables": variables})
+}
+
+// evaluate works out a watch expression in the scope of a frame,
+// heap cells are watched with an expression like [:address + 1]
+func (server *server) evaluate(message request) {
+	var arguments struct {
+		Expression string `json:"expression"`
+		FrameID    int    `json:"frameId"`
+	}
+	json.Unmarshal(message.Arguments, &arguments)
+	step, ok := server.pausedStep()
+	if !ok {
+		server.respondWithError(message, "expressions can only be evaluated while the program is paused")
+		return
+	}
+	frame, ok := frameOf(step, arguments.FrameID)
+	if !ok {
+		// a watch evaluated without a frame is in the innermost one
+		frame = 0
+	}
+
+	lineSymbols, err := lexer.Lex("<watch>", arguments.Expression)
+	if err != nil {
+		server.respondWithError(message, err.Error())
+		return
+	}
+	if len(lineSymbols) != 1 || len(lineSymbols[0]) < 2 {
+		server.respondWithError(message, "a watch is a single expression")
+		return
+	}
+	expressionSymbols := lineSymbols[0][1:]
+	expression, err := parser.ParseExpression(expressionSymbols, symbols.PositionOf(expressionSymbols[0]))
+	if err != nil {
+		server.respondWithError(message, err.Error())
+		return
+	}
+	result, err := step.Evaluate(frame, expression)
+	if err != nil {
+		server.respondWithError(message, err.Error())
+		return
+	}
+	server.respond(message, map[string]interface{}{"result": result.Literal(), "type": typeName(result), "variablesReference": 0})
+}
+
+func (server *server) source(message request) {
+	var arguments struct {
+		SourceReference int `json:"sourceReference"`
+	}
+	json.Unmarshal(message.Arguments, &arguments)
+
+	server.stateMutex.Lock()
+	defer server.stateMutex.Unlock()
+	if arguments.SourceReference < 1 || arguments.SourceReference > len(server.sources) {
+		server.respondWithError(message, "there is no sourceReference "+strconv.Itoa(arguments.SourceReference))
+		return
+	}
+	libFile, _ := stdlib.FileNamed(server.sources[arguments.SourceReference-1])
+	server.respond(message, map[string]interface{}{"content": libFile.Content, "mimeType": "text/x-morklerork"})
+}
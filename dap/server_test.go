@@ -0,0 +1,218 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"morklerork/executor"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// client plays the part of an editor, sending requests to a server and reading what it sends back
+type client struct {
+	t        *testing.T
+	requests io.Writer
+	messages chan map[string]interface{}
+	seq      int
+	// events read while waiting for something else, in the order they came
+	events []map[string]interface{}
+}
+
+func newClient(t *testing.T) *client {
+	clientToServer, requests := io.Pipe()
+	serverToClient, responses := io.Pipe()
+	client := &client{t: t, requests: requests, messages: make(chan map[string]interface{}, 100)}
+
+	done := make(chan error)
+	go func() {
+		done <- Run(clientToServer, responses, executor.DefaultHeapSize, executor.Options{})
+		responses.Close()
+	}()
+	go func() {
+		defer close(client.messages)
+		input := bufio.NewReader(serverToClient)
+		for {
+			message, err := readMessage(input)
+			if err != nil {
+				return
+			}
+			client.messages <- message
+		}
+	}()
+	t.Cleanup(func() {
+		requests.Close()
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+	})
+	return client
+}
+
+// readMessage reads the next response or event the way readRequest reads a request
+func readMessage(input *bufio.Reader) (map[string]interface{}, error) {
+	headers, err := textproto.NewReader(input).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	length, err := strconv.Atoi(headers.Get("Content-Length"))
+	if err != nil {
+		return nil, err
+	}
+	content := make([]byte, length)
+	if _, err := io.ReadFull(input, content); err != nil {
+		return nil, err
+	}
+	var message map[string]interface{}
+	err = json.Unmarshal(content, &message)
+	return message, err
+}
+
+// next is the next message from the server, failing the test if it takes too long
+func (client *client) next() map[string]interface{} {
+	client.t.Helper()
+	select {
+	case message, ok := <-client.messages:
+		if !ok {
+			client.t.Fatal("the server stopped sending messages")
+		}
+		return message
+	case <-time.After(5 * time.Second):
+		client.t.Fatal("timed out waiting for the server")
+	}
+	return nil
+}
+
+// request sends a request and returns the body of its response, which must succeed
+func (client *client) request(command string, arguments interface{}) map[string]interface{} {
+	client.t.Helper()
+	client.seq++
+	content, err := json.Marshal(map[string]interface{}{"seq": client.seq, "type": "request", "command": command, "arguments": arguments})
+	if err != nil {
+		client.t.Fatal(err)
+	}
+	if err := writeMessage(client.requests, json.RawMessage(content)); err != nil {
+		client.t.Fatal(err)
+	}
+
+	for {
+		message := client.next()
+		if message["type"] == "event" {
+			client.events = append(client.events, message)
+			continue
+		}
+		if int(message["request_seq"].(float64)) != client.seq {
+			client.t.Fatalf("expected the response to %s, got %v", command, message)
+		}
+		if message["success"] != true {
+			client.t.Fatalf("%s failed: %v", command, message["message"])
+		}
+		body, _ := message["body"].(map[string]interface{})
+		return body
+	}
+}
+
+// waitFor returns the body of the next event with a name, skipping the events before it
+func (client *client) waitFor(name string) map[string]interface{} {
+	client.t.Helper()
+	for len(client.events) > 0 {
+		event := client.events[0]
+		client.events = client.events[1:]
+		if event["event"] == name {
+			body, _ := event["body"].(map[string]interface{})
+			return body
+		}
+	}
+	for {
+		message := client.next()
+		if message["type"] == "event" && message["event"] == name {
+			body, _ := message["body"].(map[string]interface{})
+			return body
+		}
+	}
+}
+
+// the messages read back are JSON objects, so the responses are read as maps of this
+func list(body map[string]interface{}, key string) []map[string]interface{} {
+	items := make([]map[string]interface{}, 0)
+	for _, item := range body[key].([]interface{}) {
+		items = append(items, item.(map[string]interface{}))
+	}
+	return items
+}
+
+func TestDebugSession(t *testing.T) {
+	program := filepath.Join(t.TempDir(), "program.mr")
+	source := `program $double :n
+    new :result :n * 2
+    return :result
+
+new :y 0
+call :y $double 21
+log 'y is ' + :y
+`
+	if err := os.WriteFile(program, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	client := newClient(t)
+
+	capabilities := client.request("initialize", map[string]interface{}{"adapterID": "morklerork"})
+	if capabilities["supportsConfigurationDoneRequest"] != true {
+		t.Errorf("expected configurationDone to be supported, got %v", capabilities)
+	}
+	client.waitFor("initialized")
+
+	// editors set breakpoints after initialized, which can come before launch
+	breakpoints := client.request("setBreakpoints", map[string]interface{}{
+		"source":      map[string]interface{}{"path": program},
+		"breakpoints": []map[string]interface{}{{"line": 3}},
+	})
+	if set := list(breakpoints, "breakpoints"); len(set) != 1 || set[0]["verified"] != true {
+		t.Errorf("expected one verified breakpoint, got %v", breakpoints)
+	}
+	client.request("setFunctionBreakpoints", map[string]interface{}{"breakpoints": []interface{}{}})
+	client.request("launch", map[string]interface{}{"program": program})
+	client.request("configurationDone", nil)
+
+	stopped := client.waitFor("stopped")
+	if stopped["reason"] != "breakpoint" {
+		t.Errorf("expected to stop at the breakpoint, got %v", stopped)
+	}
+
+	frames := list(client.request("stackTrace", map[string]interface{}{"threadId": threadID}), "stackFrames")
+	if len(frames) != 2 || frames[0]["name"] != "$double" || frames[0]["line"] != 3.0 || frames[1]["name"] != "top level" || frames[1]["line"] != 6.0 {
+		t.Fatalf("expected $double at line 3 called from the top level at line 6, got %v", frames)
+	}
+
+	values := make(map[string]string)
+	for _, scope := range list(client.request("scopes", map[string]interface{}{"frameId": frames[0]["id"]}), "scopes") {
+		variables := client.request("variables", map[string]interface{}{"variablesReference": scope["variablesReference"]})
+		for _, variable := range list(variables, "variables") {
+			values[variable["name"].(string)] = variable["value"].(string)
+		}
+	}
+	if values[":n"] != "21" || values[":result"] != "42" {
+		t.Errorf("expected :n to be 21 and :result 42, got %v", values)
+	}
+
+	evaluated := client.request("evaluate", map[string]interface{}{"expression": ":result + 1", "frameId": frames[0]["id"]})
+	if evaluated["result"] != "43" {
+		t.Errorf("expected :result + 1 to be 43, got %v", evaluated)
+	}
+
+	client.request("continue", map[string]interface{}{"threadId": threadID})
+	output := client.waitFor("output")
+	if !strings.Contains(output["output"].(string), "y is 42") {
+		t.Errorf("expected the program to log y is 42, got %v", output)
+	}
+	if exited := client.waitFor("exited"); exited["exitCode"] != 0.0 {
+		t.Errorf("expected the program to exit with 0, got %v", exited)
+	}
+	client.waitFor("terminated")
+	client.request("disconnect", nil)
+}
@@ -0,0 +1,241 @@
+package debugger
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"morklerork/ast"
+	"morklerork/executor"
+	"morklerork/loader"
+	"morklerork/stdlib"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// errQuit is returned from the hook to stop the program when the user quits
+var errQuit = errors.New("quit")
+
+const help = `commands:
+  s, step              run the next command, stepping into calls
+  n, next              run the next command, stepping over calls
+  o, out               run until the current program returns
+  c, continue          run until the next breakpoint
+  b, break <file:line> stop before the command on a line, the file defaults to the current one
+  b, break <$program>  stop before the first command of a program, every time it is called
+  clear <breakpoint>   remove a breakpoint set with break
+  breakpoints          list the breakpoints
+  scope                print the variables in every block scope of the running program
+  stack                print the programs being run, innermost first
+  heap <first> <last>  print the heap cells from the first address to the last
+  q, quit              stop the program`
+
+type debugger struct {
+	input       *bufio.Reader
+	stdout      io.Writer
+	interpreter *executor.Interpreter
+	stepper     *Stepper
+
+	// the lines of each source file, loaded when first shown
+	sources map[string][]string
+}
+
+// Run loads a program and runs it on the tree walker, stopping before the
+// first command in fileName to read debugger commands from stdin.
+// `read` takes its input from the same stdin. The Interpreter is made with
+// heapSize and options, whose Hook is replaced by the debugger's
+func Run(fileName string, stdin io.Reader, stdout io.Writer, heapSize int, options executor.Options) error {
+	program, err := loader.Load(fileName)
+	if err != nil {
+		return err
+	}
+
+	input := bufio.NewReader(stdin)
+	debugger := &debugger{
+		input:   input,
+		stdout:  stdout,
+		stepper: NewStepper(fileName, true),
+		sources: make(map[string][]string),
+	}
+	options.Hook = debugger.beforeCommand
+	debugger.interpreter = executor.NewInterpreter(input, stdout, heapSize, options)
+
+	fmt.Fprintln(stdout, "debugging "+fileName+", type help for a list of commands")
+	err = debugger.interpreter.Execute(program)
+	if err == errQuit {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, "program finished")
+	return nil
+}
+
+// beforeCommand is the Interpreter's Hook, pausing when the Stepper says to
+func (debugger *debugger) beforeCommand(step executor.Step) error {
+	if debugger.stepper.ShouldPause(step) == "" {
+		return nil
+	}
+	return debugger.pause(step)
+}
+
+// pause reads debugger commands until one resumes the program
+func (debugger *debugger) pause(step executor.Step) error {
+	pos := ast.PositionOf(step.Command)
+	location := "the top level"
+	if callStack := step.CallStack(); len(callStack) > 0 {
+		location = callStack[len(callStack)-1].Program
+	}
+	fmt.Fprintln(debugger.stdout, "stopped at "+pos.String()+" in "+location)
+	if line, ok := debugger.sourceLine(pos.File, pos.Line); ok {
+		fmt.Fprintln(debugger.stdout, "    "+line)
+	}
+
+	for {
+		fmt.Fprint(debugger.stdout, "(debug) ")
+		line, err := debugger.input.ReadString('\n')
+		if err != nil && strings.TrimSpace(line) == "" {
+			// nothing left to read, so nothing can resume the program
+			return errQuit
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "s", "step":
+			debugger.stepper.Resume(StepInto, step)
+			return nil
+		case "n", "next":
+			debugger.stepper.Resume(StepOver, step)
+			return nil
+		case "o", "out":
+			debugger.stepper.Resume(StepOut, step)
+			return nil
+		case "c", "continue":
+			debugger.stepper.Resume(Continue, step)
+			return nil
+		case "b", "break":
+			debugger.setBreakpoint(fields[1:], pos.File, true)
+		case "clear":
+			debugger.setBreakpoint(fields[1:], pos.File, false)
+		case "breakpoints":
+			debugger.printBreakpoints()
+		case "scope":
+			debugger.printScopes(step)
+		case "stack":
+			debugger.printCallStack(step)
+		case "heap":
+			debugger.printHeap(fields[1:])
+		case "q", "quit":
+			return errQuit
+		case "help":
+			fmt.Fprintln(debugger.stdout, help)
+		default:
+			fmt.Fprintln(debugger.stdout, "unknown command "+fields[0]+", type help for a list of commands")
+		}
+	}
+}
+
+// setBreakpoint adds or removes a breakpoint on a program, or a file:line
+func (debugger *debugger) setBreakpoint(arguments []string, currentFile string, isSet bool) {
+	if len(arguments) != 1 {
+		fmt.Fprintln(debugger.stdout, "usage: break <file:line> or break <$program>")
+		return
+	}
+	breakpoint := arguments[0]
+	if strings.HasPrefix(breakpoint, "$") {
+		debugger.stepper.SetProgramBreakpoint(breakpoint, isSet)
+	} else {
+		file, lineText := currentFile, breakpoint
+		if separator := strings.LastIndex(breakpoint, ":"); separator != -1 {
+			file, lineText = breakpoint[:separator], breakpoint[separator+1:]
+		}
+		line, err := strconv.Atoi(lineText)
+		if err != nil {
+			fmt.Fprintln(debugger.stdout, "usage: break <file:line> or break <$program>")
+			return
+		}
+		debugger.stepper.SetLineBreakpoint(file, line, isSet)
+		breakpoint = file + ":" + lineText
+	}
+
+	if isSet {
+		fmt.Fprintln(debugger.stdout, "breakpoint set at "+breakpoint)
+	} else {
+		fmt.Fprintln(debugger.stdout, "breakpoint cleared at "+breakpoint)
+	}
+}
+
+func (debugger *debugger) printBreakpoints() {
+	for _, breakpoint := range debugger.stepper.Breakpoints() {
+		fmt.Fprintln(debugger.stdout, breakpoint)
+	}
+}
+
+func (debugger *debugger) printScopes(step executor.Step) {
+	for i, scope := range step.Scopes(0) {
+		fmt.Fprintln(debugger.stdout, "scope "+strconv.Itoa(i)+":")
+		for _, variable := range scope {
+			fmt.Fprintln(debugger.stdout, "  "+variable.Name+" = "+variable.Value.Literal())
+		}
+	}
+}
+
+func (debugger *debugger) printCallStack(step executor.Step) {
+	callStack := step.CallStack()
+	for i := len(callStack) - 1; i >= 0; i-- {
+		fmt.Fprintln(debugger.stdout, callStack[i].Program+" called at "+callStack[i].Pos.String())
+	}
+	fmt.Fprintln(debugger.stdout, "the top level")
+}
+
+// printHeap prints the cells from the first address to the last, inclusive
+func (debugger *debugger) printHeap(arguments []string) {
+	usage := "usage: heap <first address> <last address>"
+	if len(arguments) != 2 {
+		fmt.Fprintln(debugger.stdout, usage)
+		return
+	}
+	first, err := strconv.Atoi(arguments[0])
+	if err != nil {
+		fmt.Fprintln(debugger.stdout, usage)
+		return
+	}
+	last, err := strconv.Atoi(arguments[1])
+	if err != nil {
+		fmt.Fprintln(debugger.stdout, usage)
+		return
+	}
+
+	for address := first; address <= last; address++ {
+		cell, err := debugger.interpreter.HeapCell(address)
+		if err != nil {
+			fmt.Fprintln(debugger.stdout, err)
+			return
+		}
+		fmt.Fprintln(debugger.stdout, strconv.Itoa(address)+": "+cell.Literal())
+	}
+}
+
+// sourceLine finds the text of a line, from a file on disk or the embedded stdlib
+func (debugger *debugger) sourceLine(file string, line int) (string, bool) {
+	lines, ok := debugger.sources[file]
+	if !ok {
+		content := ""
+		if libFile, isStdlib := stdlib.FileNamed(file); isStdlib {
+			content = libFile.Content
+		} else if fileContent, err := os.ReadFile(file); err == nil {
+			content = string(fileContent)
+		}
+		lines = strings.Split(content, "\n")
+		debugger.sources[file] = lines
+	}
+	if line < 1 || line > len(lines) {
+		return "", false
+	}
+	return strings.TrimSpace(lines[line-1]), true
+}
@@ -0,0 +1,36 @@
+package debugger
+
+import (
+	"bytes"
+	"morklerork/executor"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunUsesHeapSizeAndOptions(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "program.mr")
+	source := "= [5] 1\nlog 'done\\n'\n"
+	if err := os.WriteFile(fileName, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var output bytes.Buffer
+	err := Run(fileName, strings.NewReader("c\n"), &output, 5, executor.Options{})
+	if err == nil || !strings.Contains(err.Error(), "the heap only has 5 cells") {
+		t.Errorf("expected the write past the heap of 5 cells to fail, got %v\n%s", err, output.String())
+	}
+
+	output.Reset()
+	err = Run(fileName, strings.NewReader("c\n"), &output, 5, executor.Options{GrowableHeap: true})
+	if err != nil || !strings.Contains(output.String(), "done") {
+		t.Errorf("expected the growable heap to let the program finish, got %v\n%s", err, output.String())
+	}
+
+	output.Reset()
+	err = Run(fileName, strings.NewReader("c\n"), &output, 10, executor.Options{MaxSteps: 1})
+	if err == nil || !strings.Contains(err.Error(), "MaxSteps") {
+		t.Errorf("expected MaxSteps to stop the program, got %v\n%s", err, output.String())
+	}
+}
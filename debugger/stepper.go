@@ -0,0 +1,205 @@
+package debugger
+
+import (
+	"morklerork/ast"
+	"morklerork/executor"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ResumeKind is how a paused program runs until it next pauses
+type ResumeKind int
+
+const (
+	// StepInto stops before the next command, wherever it is
+	StepInto ResumeKind = iota
+	// StepOver stops before the next command that is not inside a program called by this one
+	StepOver
+	// StepOut stops before the next command after the running program returns
+	StepOut
+	// Continue only stops at a breakpoint
+	Continue
+	// start stops before the first command of the entry file, skipping the top level of the modules it imports
+	start
+	// pauseRequested stops before the next command, because the user asked while it was running
+	pauseRequested
+)
+
+// The reasons ShouldPause gives for pausing, named as in the debug adapter protocol
+const (
+	EntryReason      = "entry"
+	StepReason       = "step"
+	BreakpointReason = "breakpoint"
+	PauseReason      = "pause"
+)
+
+// Stepper decides when a program running with an executor.Options.Hook should
+// pause, from its breakpoints and how it was last resumed.
+// Breakpoints can be changed while the program runs on another goroutine
+type Stepper struct {
+	mutex sync.Mutex
+
+	entryFile string
+	// breakpoints by the absolute path of the file and the line, or by program name
+	lineBreakpoints    map[string]bool
+	programBreakpoints map[string]bool
+
+	// absolute paths of the files in positions, since every step needs one
+	absolutePaths map[string]string
+
+	resume ResumeKind
+	// the call depth when the program was last resumed, for StepOver and StepOut
+	resumeDepth int
+	// the call depth of the previous command, a deeper command has just entered a program
+	previousDepth int
+}
+
+// NewStepper creates a Stepper with no breakpoints. If stopOnEntry is set it pauses
+// before the first command in entryFile, otherwise it runs until a breakpoint
+func NewStepper(entryFile string, stopOnEntry bool) *Stepper {
+	stepper := &Stepper{
+		entryFile:          absolutePath(entryFile),
+		lineBreakpoints:    make(map[string]bool),
+		programBreakpoints: make(map[string]bool),
+		absolutePaths:      make(map[string]string),
+		resume:             Continue,
+	}
+	if stopOnEntry {
+		stepper.resume = start
+	}
+	return stepper
+}
+
+func absolutePath(file string) string {
+	absolute, err := filepath.Abs(file)
+	if err != nil {
+		return file
+	}
+	return absolute
+}
+
+// lineBreakpoint is the key of a breakpoint in lineBreakpoints
+func (stepper *Stepper) lineBreakpoint(file string, line int) string {
+	absolute, ok := stepper.absolutePaths[file]
+	if !ok {
+		absolute = absolutePath(file)
+		stepper.absolutePaths[file] = absolute
+	}
+	return absolute + ":" + strconv.Itoa(line)
+}
+
+// ShouldPause is called with every step the program makes, returning the
+// reason to pause before it, or "" to carry on
+func (stepper *Stepper) ShouldPause(step executor.Step) string {
+	stepper.mutex.Lock()
+	defer stepper.mutex.Unlock()
+
+	pos := ast.PositionOf(step.Command)
+	depth := step.Depth()
+	enteredProgram := depth > stepper.previousDepth
+	stepper.previousDepth = depth
+
+	if stepper.lineBreakpoints[stepper.lineBreakpoint(pos.File, pos.Line)] {
+		return BreakpointReason
+	}
+	if enteredProgram {
+		callStack := step.CallStack()
+		if stepper.programBreakpoints[callStack[len(callStack)-1].Program] {
+			return BreakpointReason
+		}
+	}
+
+	switch stepper.resume {
+	case start:
+		// lineBreakpoint has already cached the absolute path
+		if stepper.absolutePaths[pos.File] == stepper.entryFile {
+			return EntryReason
+		}
+	case StepInto:
+		return StepReason
+	case StepOver:
+		if depth <= stepper.resumeDepth {
+			return StepReason
+		}
+	case StepOut:
+		if depth < stepper.resumeDepth {
+			return StepReason
+		}
+	case pauseRequested:
+		return PauseReason
+	}
+	return ""
+}
+
+// Resume sets how the program runs after the step it is paused at
+func (stepper *Stepper) Resume(kind ResumeKind, step executor.Step) {
+	stepper.mutex.Lock()
+	defer stepper.mutex.Unlock()
+	stepper.resume, stepper.resumeDepth = kind, step.Depth()
+}
+
+// Pause makes the running program pause before its next command
+func (stepper *Stepper) Pause() {
+	stepper.mutex.Lock()
+	defer stepper.mutex.Unlock()
+	stepper.resume = pauseRequested
+}
+
+// SetLineBreakpoint adds, or removes, a breakpoint before the command on a line
+func (stepper *Stepper) SetLineBreakpoint(file string, line int, isSet bool) {
+	stepper.mutex.Lock()
+	defer stepper.mutex.Unlock()
+	if isSet {
+		stepper.lineBreakpoints[stepper.lineBreakpoint(file, line)] = true
+	} else {
+		delete(stepper.lineBreakpoints, stepper.lineBreakpoint(file, line))
+	}
+}
+
+// SetProgramBreakpoint adds, or removes, a breakpoint before the first command of a program
+func (stepper *Stepper) SetProgramBreakpoint(program string, isSet bool) {
+	stepper.mutex.Lock()
+	defer stepper.mutex.Unlock()
+	if isSet {
+		stepper.programBreakpoints[program] = true
+	} else {
+		delete(stepper.programBreakpoints, program)
+	}
+}
+
+// ClearLineBreakpoints removes every breakpoint in a file
+func (stepper *Stepper) ClearLineBreakpoints(file string) {
+	stepper.mutex.Lock()
+	defer stepper.mutex.Unlock()
+	prefix := absolutePath(file) + ":"
+	for breakpoint := range stepper.lineBreakpoints {
+		if strings.HasPrefix(breakpoint, prefix) {
+			delete(stepper.lineBreakpoints, breakpoint)
+		}
+	}
+}
+
+// ClearProgramBreakpoints removes every breakpoint on a program
+func (stepper *Stepper) ClearProgramBreakpoints() {
+	stepper.mutex.Lock()
+	defer stepper.mutex.Unlock()
+	stepper.programBreakpoints = make(map[string]bool)
+}
+
+// Breakpoints lists every breakpoint, sorted
+func (stepper *Stepper) Breakpoints() []string {
+	stepper.mutex.Lock()
+	defer stepper.mutex.Unlock()
+	breakpoints := make([]string, 0, len(stepper.lineBreakpoints)+len(stepper.programBreakpoints))
+	for breakpoint := range stepper.lineBreakpoints {
+		breakpoints = append(breakpoints, breakpoint)
+	}
+	for breakpoint := range stepper.programBreakpoints {
+		breakpoints = append(breakpoints, breakpoint)
+	}
+	sort.Strings(breakpoints)
+	return breakpoints
+}
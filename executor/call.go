@@ -0,0 +1,140 @@
+package executor
+
+import (
+	"fmt"
+	"morklerork/symbols"
+)
+
+// callPos is the position given to errors about a Call itself, which has no
+// source to point at, so it is written as only Interpreter.Call
+var callPos = symbols.Position{File: "Interpreter.Call"}
+
+// ToValue converts a go int, string or bool to the Value MorkleRork uses for it.
+// A Value is returned as it is
+func ToValue(value interface{}) (Value, error) {
+	switch value := value.(type) {
+	case int:
+		return Value{Type: Int, Int: value}, nil
+	case string:
+		return Value{Type: String, String: value}, nil
+	case bool:
+		return Value{Type: Bool, Bool: value}, nil
+	case Value:
+		return value, nil
+	}
+	return Value{}, fmt.Errorf("can not convert %v of type %T to a MorkleRork value, it must be an int, string or bool", value, value)
+}
+
+// Interface converts a value to the go int, string or bool it holds
+func (result ExpressionResult) Interface() interface{} {
+	switch result.Type {
+	case Int:
+		return result.Int
+	case Bool:
+		return result.Bool
+	}
+	return result.String
+}
+
+// Call runs a program that has been created by Execute, or registered with
+// RegisterProgram, as if by a call command at the top level.
+// Each argument is converted with ToValue. The value the program returns is
+// converted back to an int, string or bool, it is nil if it returned nothing.
+// Programs and variables created by earlier calls to Execute are kept, so a
+// file can be executed once and its programs called many times
+func (interpreter *Interpreter) Call(name string, args ...interface{}) (interface{}, error) {
+	values := make([]Value, 0, len(args))
+	for i, arg := range args {
+		value, err := ToValue(arg)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d of %s: %w", i+1, name, err)
+		}
+		values = append(values, value)
+	}
+
+	interpreter.beginRun()
+	defer interpreter.endRun()
+
+	var result Value
+	var hasValue bool
+	var err error
+	if host, ok := interpreter.hostPrograms[name]; ok {
+		if err := checkArgumentCount(name, len(values), len(host.parameterNames)); err != nil {
+			return nil, err
+		}
+		result, err = interpreter.runHostProgram(host, values, callPos)
+		hasValue = true
+	} else if !interpreter.usesTreeWalker() {
+		result, hasValue, err = interpreter.callCompiled(name, values)
+	} else {
+		result, hasValue, err = interpreter.callTreeWalker(name, values)
+	}
+	if err != nil || !hasValue {
+		return nil, err
+	}
+	return result.Interface(), nil
+}
+
+func checkArgumentCount(name string, arguments int, parameters int) error {
+	if arguments != parameters {
+		return newRuntimeError(callPos, ArgumentCountError, "Tried to call "+name+" with "+fmt.Sprint(arguments)+" But it expects "+fmt.Sprint(parameters)+" parameters")
+	}
+	return nil
+}
+
+func (interpreter *Interpreter) callCompiled(name string, args []Value) (Value, bool, error) {
+	program, ok := interpreter.compiledPrograms[name]
+	if !ok {
+		return Value{}, false, newRuntimeError(callPos, UndefinedProgramError, "Tried to call "+name+" but it has not been created")
+	}
+	if err := checkArgumentCount(name, len(args), program.parameters); err != nil {
+		return Value{}, false, err
+	}
+	for _, err := range program.parameterErrors {
+		if err != nil {
+			return Value{}, false, err
+		}
+	}
+	slots := make([]ExpressionResult, program.chunk.slotCount)
+	copy(slots, args)
+	interpreter.enterProgram(name, program.pos, callPos)
+	defer interpreter.exitProgram()
+	return interpreter.runFrame(frame{chunk: program.chunk, slots: slots, program: name, callPos: callPos, arguments: args})
+}
+
+func (interpreter *Interpreter) callTreeWalker(name string, args []Value) (Value, bool, error) {
+	program, ok := interpreter.programs[name]
+	if !ok {
+		return Value{}, false, newRuntimeError(callPos, UndefinedProgramError, "Tried to call "+name+" but it has not been created")
+	}
+	if err := checkArgumentCount(name, len(args), len(program.Parameters)); err != nil {
+		return Value{}, false, err
+	}
+	scope := scope{
+		{},
+	}
+	for i, parameter := range program.Parameters {
+		if err := defineInScope(parameter.Name, args[i], scope, parameter.Pos); err != nil {
+			return Value{}, false, err
+		}
+	}
+
+	if err := interpreter.checkCallDepth(len(interpreter.callStack), callPos, interpreter.runningProgram()); err != nil {
+		return Value{}, false, err
+	}
+	interpreter.callStack = append(interpreter.callStack, CallFrame{Program: name, Pos: callPos, Arguments: args, callerScope: interpreter.globalScope})
+	interpreter.enterProgram(name, program.Pos, callPos)
+	signal, err := interpreter.executeBlock(program.Commands, scope)
+	interpreter.exitProgram()
+	if err == nil {
+		err = strayControlSignalError(signal)
+	}
+	if err != nil {
+		err = interpreter.traceError(err)
+	}
+	interpreter.callStack = interpreter.callStack[:len(interpreter.callStack)-1]
+	if err != nil {
+		return Value{}, false, err
+	}
+	return signal.value, signal.hasValue, nil
+}
@@ -0,0 +1,127 @@
+package executor
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCallErrorsNameInterpreterCall(t *testing.T) {
+	source := `program $divide :n
+    return 10 / :n
+`
+	for _, engine := range engines {
+		t.Run(engine.name, func(t *testing.T) {
+			var output bytes.Buffer
+			interpreter := NewInterpreter(strings.NewReader(""), &output, DefaultHeapSize, engine.options)
+			if err := interpreter.Execute(parse(t, source)); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := interpreter.Call("$missing")
+			expected := "Interpreter.Call: Tried to call $missing but it has not been created"
+			if err == nil || err.Error() != expected {
+				t.Errorf("expected %q, got %v", expected, err)
+			}
+
+			_, err = interpreter.Call("$divide", 0)
+			expected = "test.mr:2:15: Cannot divide by zero\n    in $divide 0, called at Interpreter.Call"
+			if err == nil || err.Error() != expected {
+				t.Errorf("expected %q, got %v", expected, err)
+			}
+		})
+	}
+}
+
+func TestCall(t *testing.T) {
+	source := `program $fib :n
+    if :n < 3
+        return 1
+    new :a 0
+    new :b 0
+    call :a $fib (:n - 1)
+    call :b $fib (:n - 2)
+    return :a + :b
+
+program $describe :name :count :isOn
+    if :isOn
+        return :name + ' ' + :count
+    return 'off'
+
+program $nothing
+    log 'ran'
+`
+	for _, engine := range engines {
+		t.Run(engine.name, func(t *testing.T) {
+			var output bytes.Buffer
+			interpreter := NewInterpreter(strings.NewReader(""), &output, DefaultHeapSize, engine.options)
+			if err := interpreter.Execute(parse(t, source)); err != nil {
+				t.Fatal(err)
+			}
+
+			if result, err := interpreter.Call("$fib", 10); err != nil || result != 55 {
+				t.Errorf("expected $fib 10 to be 55, got %v %v", result, err)
+			}
+			if result, err := interpreter.Call("$describe", "lamps", 3, true); err != nil || result != "lamps 3" {
+				t.Errorf("expected a string, int and bool to be passed, got %v %v", result, err)
+			}
+			if result, err := interpreter.Call("$describe", "lamps", 3, false); err != nil || result != "off" {
+				t.Errorf("expected ?false to be passed, got %v %v", result, err)
+			}
+			if result, err := interpreter.Call("$nothing"); err != nil || result != nil || output.String() != "ran" {
+				t.Errorf("expected nil from a program that returns nothing, got %v %v %q", result, err, output.String())
+			}
+
+			_, err := interpreter.Call("$fib", 1.5)
+			expected := "argument 1 of $fib: can not convert 1.5 of type float64 to a MorkleRork value, it must be an int, string or bool"
+			if err == nil || err.Error() != expected {
+				t.Errorf("expected %q, got %v", expected, err)
+			}
+		})
+	}
+}
+
+func TestCallProgramFromEarlierExecute(t *testing.T) {
+	for _, engine := range engines {
+		t.Run(engine.name, func(t *testing.T) {
+			var output bytes.Buffer
+			interpreter := NewInterpreter(strings.NewReader(""), &output, DefaultHeapSize, engine.options)
+			if err := interpreter.Execute(parse(t, "program $double :n\n    return :n * 2\n")); err != nil {
+				t.Fatal(err)
+			}
+			if err := interpreter.Execute(parse(t, "program $quadruple :n\n    new :twice 0\n    call :twice $double :n\n    call :twice $double :twice\n    return :twice\n")); err != nil {
+				t.Fatal(err)
+			}
+			if result, err := interpreter.Call("$double", 4); err != nil || result != 8 {
+				t.Errorf("expected $double 4 to be 8, got %v %v", result, err)
+			}
+			if result, err := interpreter.Call("$quadruple", 4); err != nil || result != 16 {
+				t.Errorf("expected $quadruple 4 to be 16, got %v %v", result, err)
+			}
+		})
+	}
+}
+
+func TestToValue(t *testing.T) {
+	tests := []struct {
+		value    interface{}
+		expected Value
+	}{
+		{7, Value{Type: Int, Int: 7}},
+		{"seven", Value{Type: String, String: "seven"}},
+		{true, Value{Type: Bool, Bool: true}},
+		{Value{Type: Int, Int: 3}, Value{Type: Int, Int: 3}},
+	}
+	for _, test := range tests {
+		value, err := ToValue(test.value)
+		if err != nil || value != test.expected {
+			t.Errorf("expected %v to be %v, got %v %v", test.value, test.expected, value, err)
+		}
+	}
+
+	for _, unsupported := range []interface{}{1.5, int64(1), nil, []int{1}} {
+		if _, err := ToValue(unsupported); err == nil {
+			t.Errorf("expected %v of type %T to be rejected", unsupported, unsupported)
+		}
+	}
+}
@@ -0,0 +1,433 @@
+package executor
+
+import (
+	"morklerork/ast"
+	"morklerork/symbols"
+)
+
+// The bytecode engine compiles []ast.Command into a chunk of instructions,
+// resolving every variable to a slot index ahead of time.
+//
+// Within a program every `new` is seen by the compiler before any command
+// after it in the same block, and blocks are always executed top to bottom,
+// so which declaration a name refers to can be worked out statically.
+// Names that can not be resolved still compile, into an instruction that
+// raises the same RuntimeError the tree walker would, if it is ever reached.
+//
+// Top level variables are the exception, they live in the Interpreter so they
+// survive between calls to Execute, and are checked as they are used.
+
+type opcode uint8
+
+const (
+	opConstant             opcode = iota // push constants[a]
+	opLoad                               // push slots[a]
+	opStore                              // pop into slots[a]
+	opLoadGlobal                         // push global a, which must be defined
+	opStoreGlobal                        // pop into global a, which must be defined
+	opDefineGlobal                       // pop into global a, which must not be defined
+	opCheckGlobalUndefined               // error if global a is defined, used before masking it
+	opUndefinedVariable                  // raise an UndefinedVariableError for names[a]
+	opRedefinedVariable                  // raise a RedefinedVariableError for names[a]
+	opLoadHeap                           // pop an address, push the heap cell
+	opStoreHeap                          // pop an address, then pop the value to store there
+	opBinaryOperator                     // pop rhs then lhs, push the result of operator a
+	opLog                                // pop a value and print it
+	opRead                               // push a rune read from stdin
+	opJump                               // continue from instruction a
+	opJumpIfFalse                        // pop a Bool, continue from a if it is false. b is the conditionKind, for errors
+	opDefineProgram                      // make programs[a] callable
+	opPrepareCall                        // look up the program names[a], checking it takes b arguments
+	opArgument                           // check the prepared program can receive argument a
+	opCall                               // call the prepared program, its return value goes to target kind a, index b
+	opReturn                             // leave the program, a is 1 if a value should be popped and returned
+	opStrayControlFlow                   // raise a ControlFlowError for a break or continue, a is the signalKind
+	opAssert                             // pop the condition of an assert, jumping to a if it is true
+	opAssertFailed                       // raise an AssertionError, popping the message first if a is 1
+	opStep                               // count a command towards the limits in Options, only emitted if there are any
+	opCountCommand                       // count a run of the command starting here, only emitted if Options.Coverage or Options.Profile is set
+)
+
+// the kinds of place a call can put its return value
+const (
+	noReturnTarget = iota
+	localReturnTarget
+	globalReturnTarget
+	undefinedReturnTarget
+)
+
+// the commands an opJumpIfFalse can come from
+const (
+	ifCondition = iota
+	whileCondition
+	elseIfCondition
+	assertCondition
+)
+
+var conditionNames = []string{
+	ifCondition:     "If",
+	whileCondition:  "While",
+	elseIfCondition: "Elif",
+	assertCondition: "Assert",
+}
+
+type instruction struct {
+	op opcode
+	a  int
+	b  int
+}
+
+type chunk struct {
+	code []instruction
+	// positions[i] is where code[i] came from, for errors
+	positions []symbols.Position
+	constants []ExpressionResult
+	names     []string
+	programs  []*compiledProgram
+	slotCount int
+}
+
+type compiledProgram struct {
+	name           string
+	pos            symbols.Position
+	parameters     int
+	parameterNames []string
+	// parameterErrors[i] is set if parameter i repeats an earlier parameter name
+	parameterErrors []*RuntimeError
+	chunk           *chunk
+}
+
+// globalTable gives every top level variable name a fixed index into the Interpreter's globals
+type globalTable struct {
+	indexes map[string]int
+	names   []string
+}
+
+// loop is a while being compiled, so break and continue know where to jump
+type loop struct {
+	start int
+	// breakJumps are patched to the end of the loop once it is known
+	breakJumps []int
+}
+
+type compiler struct {
+	chunk *chunk
+	// block scopes within the frame being compiled, innermost last
+	scopes []map[string]int
+	// whiles within the frame being compiled, innermost last
+	loops []loop
+	// globals is only set when compiling top level code
+	globals *globalTable
+	// countSteps emits an opStep before each command
+	countSteps bool
+	// countCommands emits an opCountCommand before each command
+	countCommands bool
+}
+
+func (compiler *compiler) emit(op opcode, a int, b int, pos symbols.Position) int {
+	compiler.chunk.code = append(compiler.chunk.code, instruction{op: op, a: a, b: b})
+	compiler.chunk.positions = append(compiler.chunk.positions, pos)
+	return len(compiler.chunk.code) - 1
+}
+
+// patchJump points the jump at index to the next instruction to be emitted
+func (compiler *compiler) patchJump(index int) {
+	compiler.chunk.code[index].a = len(compiler.chunk.code)
+}
+
+func (compiler *compiler) addConstant(val ExpressionResult) int {
+	compiler.chunk.constants = append(compiler.chunk.constants, val)
+	return len(compiler.chunk.constants) - 1
+}
+
+func (compiler *compiler) addName(name string) int {
+	for i, existing := range compiler.chunk.names {
+		if existing == name {
+			return i
+		}
+	}
+	compiler.chunk.names = append(compiler.chunk.names, name)
+	return len(compiler.chunk.names) - 1
+}
+
+func (compiler *compiler) isTopLevel() bool {
+	return compiler.globals != nil && len(compiler.scopes) == 0
+}
+
+// resolveLocal finds the slot for name in the enclosing block scopes
+func (compiler *compiler) resolveLocal(name string) (int, bool) {
+	for i := len(compiler.scopes) - 1; i >= 0; i-- {
+		slot, ok := compiler.scopes[i][name]
+		if ok {
+			return slot, true
+		}
+	}
+	return 0, false
+}
+
+func (compiler *compiler) resolveGlobal(name string) (int, bool) {
+	if compiler.globals == nil {
+		return 0, false
+	}
+	index, ok := compiler.globals.indexes[name]
+	return index, ok
+}
+
+func (compiler *compiler) addGlobal(name string) int {
+	index, ok := compiler.globals.indexes[name]
+	if !ok {
+		index = len(compiler.globals.names)
+		compiler.globals.indexes[name] = index
+		compiler.globals.names = append(compiler.globals.names, name)
+	}
+	return index
+}
+
+func (compiler *compiler) declareLocal(name string) int {
+	slot := compiler.chunk.slotCount
+	compiler.chunk.slotCount++
+	compiler.scopes[len(compiler.scopes)-1][name] = slot
+	return slot
+}
+
+func (compiler *compiler) compileVariableLoad(variable ast.VariableName) {
+	if slot, ok := compiler.resolveLocal(variable.Name); ok {
+		compiler.emit(opLoad, slot, 0, variable.Pos)
+	} else if index, ok := compiler.resolveGlobal(variable.Name); ok {
+		compiler.emit(opLoadGlobal, index, 0, variable.Pos)
+	} else {
+		compiler.emit(opUndefinedVariable, compiler.addName(variable.Name), 0, variable.Pos)
+	}
+}
+
+func (compiler *compiler) compileVariableStore(variable ast.VariableName) {
+	if slot, ok := compiler.resolveLocal(variable.Name); ok {
+		compiler.emit(opStore, slot, 0, variable.Pos)
+	} else if index, ok := compiler.resolveGlobal(variable.Name); ok {
+		compiler.emit(opStoreGlobal, index, 0, variable.Pos)
+	} else {
+		compiler.emit(opUndefinedVariable, compiler.addName(variable.Name), 0, variable.Pos)
+	}
+}
+
+func (compiler *compiler) compileExpression(expression ast.Expression) {
+	switch expression := expression.(type) {
+	case ast.StringLiteral:
+		compiler.emit(opConstant, compiler.addConstant(ExpressionResult{Type: String, String: expression.Value}), 0, expression.Pos)
+	case ast.IntLiteral:
+		compiler.emit(opConstant, compiler.addConstant(ExpressionResult{Type: Int, Int: expression.Value}), 0, expression.Pos)
+	case ast.BooleanLiteral:
+		compiler.emit(opConstant, compiler.addConstant(ExpressionResult{Type: Bool, Bool: expression.Value}), 0, expression.Pos)
+	case ast.VariableName:
+		compiler.compileVariableLoad(expression)
+	case ast.HeapAccess:
+		compiler.compileExpression(expression.IndexExpression)
+		compiler.emit(opLoadHeap, 0, 0, expression.Pos)
+	case ast.BinaryOperator:
+		compiler.compileExpression(expression.Lhs)
+		compiler.compileExpression(expression.Rhs)
+		compiler.emit(opBinaryOperator, int(expression.BinaryOperatorType), 0, expression.Pos)
+	}
+}
+
+// compileStoreToTarget stores the value on top of the stack into a Variable or HeapAccess
+func (compiler *compiler) compileStoreToTarget(target ast.Expression) {
+	switch target := target.(type) {
+	case ast.VariableName:
+		compiler.compileVariableStore(target)
+	case ast.HeapAccess:
+		compiler.compileExpression(target.IndexExpression)
+		compiler.emit(opStoreHeap, 0, 0, target.Pos)
+	}
+}
+
+func (compiler *compiler) compileBlock(commands []ast.Command) {
+	compiler.scopes = append(compiler.scopes, make(map[string]int))
+	for _, command := range commands {
+		compiler.compileCommand(command)
+	}
+	compiler.scopes = compiler.scopes[:len(compiler.scopes)-1]
+}
+
+func (compiler *compiler) compileNew(define ast.New) {
+	compiler.compileExpression(define.Expr)
+
+	if compiler.isTopLevel() {
+		compiler.emit(opDefineGlobal, compiler.addGlobal(define.VariableName), 0, define.Pos)
+		return
+	}
+
+	if _, ok := compiler.resolveLocal(define.VariableName); ok {
+		compiler.emit(opRedefinedVariable, compiler.addName(define.VariableName), 0, define.Pos)
+		return
+	}
+	if index, ok := compiler.resolveGlobal(define.VariableName); ok {
+		compiler.emit(opCheckGlobalUndefined, index, 0, define.Pos)
+	}
+	compiler.emit(opStore, compiler.declareLocal(define.VariableName), 0, define.Pos)
+}
+
+func (compiler *compiler) compileCall(call ast.Call) {
+	compiler.emit(opPrepareCall, compiler.addName(call.Name.Name), len(call.Expressions), call.Pos)
+	for i, expression := range call.Expressions {
+		compiler.compileExpression(expression)
+		compiler.emit(opArgument, i, 0, call.Pos)
+	}
+
+	if !call.HasReturnTarget {
+		compiler.emit(opCall, noReturnTarget, 0, call.Pos)
+	} else if slot, ok := compiler.resolveLocal(call.ReturnTarget.Name); ok {
+		compiler.emit(opCall, localReturnTarget, slot, call.ReturnTarget.Pos)
+	} else if index, ok := compiler.resolveGlobal(call.ReturnTarget.Name); ok {
+		compiler.emit(opCall, globalReturnTarget, index, call.ReturnTarget.Pos)
+	} else {
+		compiler.emit(opCall, undefinedReturnTarget, compiler.addName(call.ReturnTarget.Name), call.ReturnTarget.Pos)
+	}
+}
+
+// compileIf lays out each condition followed by its block, every block
+// jumps to the end once it is done so only one of them runs
+func (compiler *compiler) compileIf(ifCommand ast.If) {
+	endJumps := make([]int, 0)
+
+	compiler.compileExpression(ifCommand.Cond)
+	jump := compiler.emit(opJumpIfFalse, 0, ifCondition, ifCommand.Pos)
+	compiler.compileBlock(ifCommand.Commands)
+
+	for _, elseIf := range ifCommand.ElseIfs {
+		endJumps = append(endJumps, compiler.emit(opJump, 0, 0, elseIf.Pos))
+		compiler.patchJump(jump)
+		compiler.compileExpression(elseIf.Cond)
+		jump = compiler.emit(opJumpIfFalse, 0, elseIfCondition, elseIf.Pos)
+		compiler.compileBlock(elseIf.Commands)
+	}
+
+	if ifCommand.HasElse {
+		endJumps = append(endJumps, compiler.emit(opJump, 0, 0, ifCommand.Else.Pos))
+		compiler.patchJump(jump)
+		compiler.compileBlock(ifCommand.Else.Commands)
+	} else {
+		compiler.patchJump(jump)
+	}
+
+	for _, endJump := range endJumps {
+		compiler.patchJump(endJump)
+	}
+}
+
+func (compiler *compiler) compileCommand(command ast.Command) {
+	if compiler.countSteps {
+		compiler.emit(opStep, 0, 0, ast.PositionOf(command))
+	}
+	if compiler.countCommands {
+		compiler.emit(opCountCommand, 0, 0, ast.PositionOf(command))
+	}
+	switch command := command.(type) {
+	case ast.Log:
+		compiler.compileExpression(command.Expr)
+		compiler.emit(opLog, 0, 0, command.Pos)
+	case ast.Read:
+		compiler.emit(opRead, 0, 0, command.Pos)
+		compiler.compileStoreToTarget(command.Target)
+	case ast.Assign:
+		compiler.compileExpression(command.Expr)
+		compiler.compileStoreToTarget(command.Target)
+	case ast.New:
+		compiler.compileNew(command)
+	case ast.If:
+		compiler.compileIf(command)
+	case ast.While:
+		start := len(compiler.chunk.code)
+		compiler.compileExpression(command.Cond)
+		jump := compiler.emit(opJumpIfFalse, 0, whileCondition, command.Pos)
+		compiler.loops = append(compiler.loops, loop{start: start})
+		compiler.compileBlock(command.Commands)
+		compiler.emit(opJump, start, 0, command.Pos)
+		compiler.patchJump(jump)
+		for _, breakJump := range compiler.loops[len(compiler.loops)-1].breakJumps {
+			compiler.patchJump(breakJump)
+		}
+		compiler.loops = compiler.loops[:len(compiler.loops)-1]
+	case ast.Program:
+		compiler.chunk.programs = append(compiler.chunk.programs, compileProgram(command, compiler.countSteps, compiler.countCommands))
+		compiler.emit(opDefineProgram, len(compiler.chunk.programs)-1, 0, command.Pos)
+	case ast.Call:
+		compiler.compileCall(command)
+	case ast.Return:
+		if command.HasExpression {
+			compiler.compileExpression(command.Expression)
+			compiler.emit(opReturn, 1, 0, command.Pos)
+		} else {
+			compiler.emit(opReturn, 0, 0, command.Pos)
+		}
+	case ast.Break:
+		if len(compiler.loops) == 0 {
+			compiler.emit(opStrayControlFlow, int(breakSignal), 0, command.Pos)
+			return
+		}
+		innermost := &compiler.loops[len(compiler.loops)-1]
+		innermost.breakJumps = append(innermost.breakJumps, compiler.emit(opJump, 0, 0, command.Pos))
+	case ast.Continue:
+		if len(compiler.loops) == 0 {
+			compiler.emit(opStrayControlFlow, int(continueSignal), 0, command.Pos)
+			return
+		}
+		compiler.emit(opJump, compiler.loops[len(compiler.loops)-1].start, 0, command.Pos)
+	case ast.Assert:
+		// the message is only evaluated if the condition is false
+		compiler.compileExpression(command.Cond)
+		jump := compiler.emit(opAssert, 0, assertCondition, command.Pos)
+		if command.HasMessage {
+			compiler.compileExpression(command.Message)
+			compiler.emit(opAssertFailed, 1, 0, command.Pos)
+		} else {
+			compiler.emit(opAssertFailed, 0, 0, command.Pos)
+		}
+		compiler.patchJump(jump)
+	}
+}
+
+// compileProgram compiles the body of a program into its own chunk
+// Its parameters take the first slots, in order
+func compileProgram(program ast.Program, countSteps bool, countCommands bool) *compiledProgram {
+	compiler := &compiler{
+		chunk:         &chunk{},
+		scopes:        []map[string]int{make(map[string]int)},
+		countSteps:    countSteps,
+		countCommands: countCommands,
+	}
+	compiled := &compiledProgram{
+		name:            program.Name.Name,
+		pos:             program.Pos,
+		parameters:      len(program.Parameters),
+		parameterErrors: make([]*RuntimeError, len(program.Parameters)),
+		chunk:           compiler.chunk,
+	}
+
+	for i, parameter := range program.Parameters {
+		compiled.parameterNames = append(compiled.parameterNames, parameter.Name)
+		if _, ok := compiler.scopes[0][parameter.Name]; ok {
+			compiled.parameterErrors[i] = newRuntimeError(parameter.Pos, RedefinedVariableError, "VariableName "+parameter.Name+" is already defined in this scope")
+		}
+		// every parameter gets its own slot, even a repeated one, so argument i always lands in slot i
+		compiler.chunk.slotCount++
+		compiler.scopes[0][parameter.Name] = i
+	}
+
+	compiler.compileBlock(program.Commands)
+	return compiled
+}
+
+// compileTopLevel compiles commands that run directly in the Interpreter's global scope
+func (interpreter *Interpreter) compileTopLevel(program []ast.Command) *chunk {
+	compiler := &compiler{
+		chunk:         &chunk{},
+		globals:       interpreter.globalNames,
+		countSteps:    interpreter.options.hasStepLimits(),
+		countCommands: interpreter.options.Coverage != nil || interpreter.options.Profile != nil,
+	}
+	for _, command := range program {
+		compiler.compileCommand(command)
+	}
+	return compiler.chunk
+}
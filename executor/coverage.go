@@ -0,0 +1,133 @@
+package executor
+
+import (
+	"morklerork/ast"
+	"morklerork/symbols"
+	"sort"
+)
+
+// Coverage records how many times each command ran, and how many times the
+// condition of each if, elif and while was true and false. Give the same
+// Coverage to many Interpreters, such as one for each test, to add up what
+// all of them ran
+type Coverage struct {
+	commands map[symbols.Position]int
+	branches map[symbols.Position]*BranchCount
+}
+
+// CommandCount is how many times the command at Pos ran
+type CommandCount struct {
+	Pos   symbols.Position
+	Count int
+}
+
+// BranchCount is how many times a condition was true and false. Kind is
+// "If", "Elif" or "While", and Pos is where that part of the command starts
+type BranchCount struct {
+	Pos   symbols.Position
+	Kind  string
+	True  int
+	False int
+}
+
+// NewCoverage creates a Coverage with nothing recorded, to give to Options.Coverage
+func NewCoverage() *Coverage {
+	return &Coverage{
+		commands: make(map[symbols.Position]int),
+		branches: make(map[symbols.Position]*BranchCount),
+	}
+}
+
+// add records every command in commands and the blocks inside them as not
+// having run yet, unless they already have a count, so commands that never
+// run are still in the Coverage
+func (coverage *Coverage) add(commands []ast.Command) {
+	for _, command := range commands {
+		pos := ast.PositionOf(command)
+		if _, ok := coverage.commands[pos]; !ok {
+			coverage.commands[pos] = 0
+		}
+		switch command := command.(type) {
+		case ast.If:
+			coverage.addBranch(command.Pos, ifCondition)
+			coverage.add(command.Commands)
+			for _, elseIf := range command.ElseIfs {
+				coverage.addBranch(elseIf.Pos, elseIfCondition)
+				coverage.add(elseIf.Commands)
+			}
+			if command.HasElse {
+				coverage.add(command.Else.Commands)
+			}
+		case ast.While:
+			coverage.addBranch(command.Pos, whileCondition)
+			coverage.add(command.Commands)
+		case ast.Program:
+			coverage.add(command.Commands)
+		}
+	}
+}
+
+func (coverage *Coverage) addBranch(pos symbols.Position, kind int) {
+	if _, ok := coverage.branches[pos]; !ok {
+		coverage.branches[pos] = &BranchCount{Pos: pos, Kind: conditionNames[kind]}
+	}
+}
+
+// ran counts a run of the command at pos, a nil Coverage records nothing
+func (coverage *Coverage) ran(pos symbols.Position) {
+	if coverage != nil {
+		coverage.commands[pos]++
+	}
+}
+
+// branch counts the result of the condition of the command at pos
+func (coverage *Coverage) branch(pos symbols.Position, result bool) {
+	if coverage == nil {
+		return
+	}
+	count, ok := coverage.branches[pos]
+	if !ok {
+		return
+	}
+	if result {
+		count.True++
+	} else {
+		count.False++
+	}
+}
+
+// Commands lists every command that has been executed, or could have been,
+// with how many times it ran, in order of file then position
+func (coverage *Coverage) Commands() []CommandCount {
+	counts := make([]CommandCount, 0, len(coverage.commands))
+	for pos, count := range coverage.commands {
+		counts = append(counts, CommandCount{Pos: pos, Count: count})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		return positionLess(counts[i].Pos, counts[j].Pos)
+	})
+	return counts
+}
+
+// Branches lists the condition of every if, elif and while in the
+// Commands, in order of file then position
+func (coverage *Coverage) Branches() []BranchCount {
+	counts := make([]BranchCount, 0, len(coverage.branches))
+	for _, count := range coverage.branches {
+		counts = append(counts, *count)
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		return positionLess(counts[i].Pos, counts[j].Pos)
+	})
+	return counts
+}
+
+func positionLess(a symbols.Position, b symbols.Position) bool {
+	if a.File != b.File {
+		return a.File < b.File
+	}
+	if a.Line != b.Line {
+		return a.Line < b.Line
+	}
+	return a.Column < b.Column
+}
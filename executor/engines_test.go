@@ -0,0 +1,252 @@
+package executor
+
+import (
+	"testing"
+)
+
+// TestEnginesAgree runs each program on both engines, which must log the
+// same things and stop with the same error, at the same position
+func TestEnginesAgree(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		output string
+		err    string
+	}{
+		{
+			name: "a block cannot define a variable again",
+			source: `new :index 5
+if :index < 10
+    new :index 'Hello '
+`,
+			err: "test.mr:3:5: VariableName :index is already defined in this scope",
+		},
+		{
+			name: "assigning from a block changes the outer variable",
+			source: `new :x 1
+if ?true
+    = :x :x + 1
+    if ?true
+        = :x :x * 10
+log :x
+`,
+			output: "20",
+		},
+		{
+			name: "a program does not see globals",
+			source: `new :x 1
+program $f :a
+    log :x
+call $f 2
+`,
+			err: "test.mr:3:9: Could not find variable :x in scope. Did you declare it first?\n    in $f 2, called at test.mr:4:1",
+		},
+		{
+			name: "a variable is gone once its block ends",
+			source: `if ?true
+    new :inner 1
+log :inner
+`,
+			err: "test.mr:3:5: Could not find variable :inner in scope. Did you declare it first?",
+		},
+		{
+			name: "if, elif and else run one block",
+			source: `program $sign :n
+    if :n < 0
+        log '-'
+    elif :n == 0
+        log '0'
+    else
+        log '+'
+call $sign (0 - 4)
+call $sign 0
+call $sign 7
+`,
+			output: "-0+",
+		},
+		{
+			name: "while with break and continue",
+			source: `new :num 0
+while ?true
+    = :num :num + 1
+    if :num % 2 == 0
+        continue
+    if 7 < :num
+        break
+    log :num
+`,
+			output: "1357",
+		},
+		{
+			name: "a while block is a new scope every time",
+			source: `new :i 0
+while :i < 3
+    new :square :i * :i
+    log '' + :square + ','
+    = :i :i + 1
+`,
+			output: "0,1,4,",
+		},
+		{
+			name: "recursion",
+			source: `program $fib :n
+    if :n < 3
+        return 1
+    new :a 0
+    new :b 0
+    call :a $fib (:n - 1)
+    call :b $fib (:n - 2)
+    return :a + :b
+new :result 0
+call :result $fib 15
+log :result
+`,
+			output: "610",
+		},
+		{
+			name: "heap cells hold any value",
+			source: `= [0] 3
+= [[0]] 'three'
+= [[0] + 1] ?true
+log [3] + ' ' + [4] + ' ' + [0]
+`,
+			output: "three true 3",
+		},
+		{
+			name: "strings",
+			source: `new :s 'it\'s '
+= :s :s + 4 + '\x41'
+log :s
+if 'a' == 'a' & 'a' != 'b'
+    log '!'
+`,
+			output: "it's 4A!",
+		},
+		{
+			name: "dividing by zero",
+			source: `new :zero 0
+log 10 / :zero
+`,
+			err: "test.mr:2:8: Cannot divide by zero",
+		},
+		{
+			name: "an operator on the wrong types",
+			source: `new :x 'abc' - 1
+`,
+			err: "test.mr:1:14: Cannot use - on string and int",
+		},
+		{
+			name: "an error deep in calls has a trace",
+			source: `program $inner :n
+    if :n == 3
+        new :s 'x'
+        log :s * 2
+    return :n
+program $outer :n
+    new :r 0
+    call :r $inner :n
+    return :r
+new :i 0
+while :i < 5
+    = :i :i + 1
+    new :got 0
+    call :got $outer :i
+`,
+			err: "test.mr:4:16: Cannot use * on string and int\n    in $inner 3, called at test.mr:8:5\n    in $outer 3, called at test.mr:14:5",
+		},
+		{
+			name: "reading past the heap",
+			source: `log [10000]
+`,
+			err: "test.mr:1:5: Tried to read heap address 10000, but the heap only has 10000 cells, from 0 to 9999",
+		},
+		{
+			name: "calling with the wrong number of values",
+			source: `program $f :a :b
+    return :a
+call $f 1
+`,
+			err: "test.mr:3:1: Tried to call $f with 1 But it expects 2 parameters",
+		},
+		{
+			name: "calling a program that does not exist",
+			source: `call $missing 1
+`,
+			err: "test.mr:1:1: Tried to call $missing but it has not been created",
+		},
+		{
+			name: "a condition that is not a boolean",
+			source: `if 1
+    log 'a'
+`,
+			err: "test.mr:1:1: If condition did not evaluate to a boolean",
+		},
+		{
+			name: "break outside of a loop",
+			source: `break
+`,
+			err: "test.mr:1:1: break used outside of a while loop",
+		},
+		{
+			// the compiler gives every variable a slot, and sibling blocks can
+			// reuse one, so each use must find the variable that is in scope
+			name: "names resolve to the slot in scope",
+			source: `new :y 'y '
+if ?true
+    new :x 'first '
+    if ?true
+        log :x + :y
+        new :w 'inner '
+        log :w
+        = :y 'changed '
+    if ?true
+        new :w 'again '
+        log :w
+    log :x
+if ?true
+    new :x 'sibling '
+    log :x
+log :y
+`,
+			output: "first y inner again first sibling changed ",
+		},
+		{
+			name: "parameters have their own slots in each call",
+			source: `program $count :n :total
+    if :n == 0
+        return :total
+    new :next 0
+    call :next $count (:n - 1) (:total + :n)
+    log :n
+    return :next
+new :sum 0
+call :sum $count 4 0
+log ' ' + :sum
+`,
+			output: "1234 10",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			results := make([]string, 0, len(engines))
+			for _, engine := range engines {
+				output, err := run(t, test.source, engine.options)
+				errText := ""
+				if err != nil {
+					errText = err.Error()
+				}
+				if output != test.output {
+					t.Errorf("%s logged %q, expected %q", engine.name, output, test.output)
+				}
+				if errText != test.err {
+					t.Errorf("%s stopped with %q, expected %q", engine.name, errText, test.err)
+				}
+				results = append(results, output+"\n"+errText)
+			}
+			if results[0] != results[1] {
+				t.Errorf("the engines disagree:\n%s\n%s", results[0], results[1])
+			}
+		})
+	}
+}
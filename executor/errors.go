@@ -0,0 +1,73 @@
+package executor
+
+import (
+	"fmt"
+	"morklerork/symbols"
+)
+
+// RuntimeErrorKind is what went wrong in a RuntimeError
+type RuntimeErrorKind int
+
+const (
+	UndefinedVariableError RuntimeErrorKind = iota
+	RedefinedVariableError
+	TypeError
+	UndefinedProgramError
+	ArgumentCountError
+	DivideByZeroError
+	IndexError
+	InputError
+	UnrecognisedNodeError
+	ControlFlowError
+	HostError
+	LimitError
+	AssertionError
+	RedefinedProgramError
+)
+
+// RuntimeError is returned by ExecuteProgram when a command fails,
+// execution stops at the first RuntimeError
+type RuntimeError struct {
+	Pos     symbols.Position
+	Kind    RuntimeErrorKind
+	Message string
+	// Trace is the programs that were running when the command failed,
+	// outermost first. It is empty if the command was at the top level
+	Trace []CallFrame
+}
+
+// traceEnds is how many frames are written from each end of a long Trace
+const traceEnds = 10
+
+// Error writes the message, then a line for each program in the Trace,
+// innermost first. Only the ends of a long Trace are written, such as one
+// from a runaway recursion
+func (err *RuntimeError) Error() string {
+	message := err.Pos.String() + ": " + err.Message
+	for i := len(err.Trace) - 1; i >= 0; i-- {
+		if i == len(err.Trace)-1-traceEnds && len(err.Trace) > 2*traceEnds {
+			message += fmt.Sprintf("\n    ... %d more calls", len(err.Trace)-2*traceEnds)
+			// carry on from the outermost traceEnds frames
+			i = traceEnds
+			continue
+		}
+		message += "\n    in " + err.Trace[i].String()
+	}
+	return message
+}
+
+// withTrace adds trace to a RuntimeError that does not have one yet.
+// The error is copied, as some RuntimeErrors are made once and returned many times
+func withTrace(err error, trace []CallFrame) error {
+	runtimeErr, ok := err.(*RuntimeError)
+	if !ok || len(runtimeErr.Trace) > 0 || len(trace) == 0 {
+		return err
+	}
+	traced := *runtimeErr
+	traced.Trace = trace
+	return &traced
+}
+
+func newRuntimeError(pos symbols.Position, kind RuntimeErrorKind, message string) *RuntimeError {
+	return &RuntimeError{Pos: pos, Kind: kind, Message: message}
+}
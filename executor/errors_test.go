@@ -0,0 +1,62 @@
+package executor
+
+import (
+	"fmt"
+	"morklerork/symbols"
+	"strings"
+	"testing"
+)
+
+// frames makes a Trace of count calls, $p0 outermost, each called on the line of its number
+func frames(count int) []CallFrame {
+	trace := make([]CallFrame, 0, count)
+	for i := 0; i < count; i++ {
+		trace = append(trace, CallFrame{Program: fmt.Sprintf("$p%d", i), Pos: symbols.Position{File: "test.mr", Line: i + 1, Column: 1}})
+	}
+	return trace
+}
+
+func TestShortTraceIsWrittenInFull(t *testing.T) {
+	err := &RuntimeError{Pos: symbols.Position{File: "test.mr", Line: 1, Column: 1}, Message: "failed", Trace: frames(2 * traceEnds)}
+	lines := strings.Split(err.Error(), "\n")
+	if len(lines) != 1+2*traceEnds {
+		t.Fatalf("expected the message and %d frames, got %d lines:\n%s", 2*traceEnds, len(lines), err.Error())
+	}
+	for i, line := range lines[1:] {
+		frame := 2*traceEnds - 1 - i
+		expected := fmt.Sprintf("    in $p%d, called at test.mr:%d:1", frame, frame+1)
+		if line != expected {
+			t.Errorf("expected line %d to be %q, got %q", i+1, expected, line)
+		}
+	}
+}
+
+func TestLongTraceIsElided(t *testing.T) {
+	err := &RuntimeError{Pos: symbols.Position{File: "test.mr", Line: 1, Column: 1}, Message: "failed", Trace: frames(25)}
+	expected := []string{"test.mr:1:1: failed"}
+	for frame := 24; frame >= 15; frame-- {
+		expected = append(expected, fmt.Sprintf("    in $p%d, called at test.mr:%d:1", frame, frame+1))
+	}
+	expected = append(expected, "    ... 5 more calls")
+	for frame := 9; frame >= 0; frame-- {
+		expected = append(expected, fmt.Sprintf("    in $p%d, called at test.mr:%d:1", frame, frame+1))
+	}
+	if err.Error() != strings.Join(expected, "\n") {
+		t.Errorf("expected\n%s\ngot\n%s", strings.Join(expected, "\n"), err.Error())
+	}
+}
+
+func TestRunawayRecursionTraceCountsEveryCall(t *testing.T) {
+	err := &RuntimeError{Pos: symbols.Position{File: "test.mr", Line: 1, Column: 1}, Message: "failed", Trace: frames(DefaultMaxCallDepth)}
+	lines := strings.Split(err.Error(), "\n")
+	if len(lines) != 2+2*traceEnds {
+		t.Fatalf("expected the message, %d frames and the elision, got %d lines", 2*traceEnds, len(lines))
+	}
+	elided := fmt.Sprintf("    ... %d more calls", DefaultMaxCallDepth-2*traceEnds)
+	if lines[1+traceEnds] != elided {
+		t.Errorf("expected %q, got %q", elided, lines[1+traceEnds])
+	}
+	if last := lines[len(lines)-1]; last != "    in $p0, called at test.mr:1:1" {
+		t.Errorf("expected the outermost call last, got %q", last)
+	}
+}
@@ -1,14 +1,11 @@
 package executor
 
 import (
-	"bufio"
 	"errors"
 	"fmt"
-	"golang.org/x/crypto/ssh/terminal"
-	"log"
 	"morklerork/ast"
+	"morklerork/lexer"
 	"morklerork/symbols"
-	"os"
 	"strconv"
 )
 
@@ -27,41 +24,83 @@ type ExpressionResult struct {
 	Type   ResultType
 }
 
+// Literal writes the value the way it would be written in MorkleRork source
+func (result ExpressionResult) Literal() string {
+	switch result.Type {
+	case Int:
+		return strconv.Itoa(result.Int)
+	case Bool:
+		if result.Bool {
+			return "?true"
+		}
+		return "?false"
+	}
+	return lexer.Quote(result.String)
+}
+
 type scope []map[string]ExpressionResult
 
+type signalKind int
+
+const (
+	noSignal signalKind = iota
+	returnSignal
+	breakSignal
+	continueSignal
+)
+
+// controlSignal tells the commands around a block why it stopped early.
+// A return carries its value up to runCall, break and continue stop at the nearest runWhile
+type controlSignal struct {
+	kind     signalKind
+	value    ExpressionResult
+	hasValue bool
+	pos      symbols.Position
+}
+
+// strayControlSignalError reports a break or continue that reached a program or the top level
+func strayControlSignalError(signal controlSignal) error {
+	switch signal.kind {
+	case breakSignal:
+		return newRuntimeError(signal.pos, ControlFlowError, "break used outside of a while loop")
+	case continueSignal:
+		return newRuntimeError(signal.pos, ControlFlowError, "continue used outside of a while loop")
+	}
+	return nil
+}
+
 type programs map[string]ast.Program
 
-func assignInScope(name string, val ExpressionResult, scope scope) {
+func assignInScope(name string, val ExpressionResult, scope scope, pos symbols.Position) error {
 	for i := len(scope) - 1; i >= 0; i-- {
 		_, ok := scope[i][name]
 		if ok {
 			scope[i][name] = val
-			return
+			return nil
 		}
 	}
-	log.Fatal("Could not find variable " + name + " in scope. Did you declare it first?")
+	return newRuntimeError(pos, UndefinedVariableError, "Could not find variable "+name+" in scope. Did you declare it first?")
 }
 
-func defineInScope(name string, val ExpressionResult, scope scope) {
+func defineInScope(name string, val ExpressionResult, scope scope, pos symbols.Position) error {
 	for i := len(scope) - 1; i >= 0; i-- {
 		_, ok := scope[i][name]
 		if ok {
-			log.Fatal("VariableName " + name + " is already defined in this scope")
-			return
+			return newRuntimeError(pos, RedefinedVariableError, "VariableName "+name+" is already defined in this scope")
 		}
 	}
 	scope[len(scope)-1][name] = val
+	return nil
 }
 
-func getInScope(name string, scope scope) ExpressionResult {
+func getInScope(name string, scope scope, pos symbols.Position) (ExpressionResult, error) {
 	for i := len(scope) - 1; i >= 0; i-- {
 		val, ok := scope[i][name]
 		if ok {
-			return val
+			return val, nil
 		}
 	}
-	log.Fatal("Could not find variable " + name + " in scope. Did you declare it first?")
-	return ExpressionResult{}
+	return ExpressionResult{}, newRuntimeError(pos, UndefinedVariableError, "Could not find variable "+name+" in scope. Did you declare it first?")
 }
 
 func isInScope(name string, scope scope) bool {
@@ -82,8 +121,6 @@ func popScope(scope scope) scope {
 	return scope[:len(scope)-1]
 }
 
-var heap [10000]ExpressionResult
-
 func executeBinaryOperatorOnString(lhs ExpressionResult, rhs ExpressionResult, operatorType symbols.BinaryOperatorType) (ExpressionResult, error) {
 	switch rhs.Type {
 	case String:
@@ -102,7 +139,11 @@ func executeBinaryOperatorOnString(lhs ExpressionResult, rhs ExpressionResult, o
 		case symbols.PlusOperator:
 			return ExpressionResult{String: lhs.String + strconv.Itoa(rhs.Int), Type: String}, nil
 		case symbols.ModuloOperator:
-			return ExpressionResult{String: string([]rune(lhs.String)[rhs.Int]), Type: String}, nil
+			runes := []rune(lhs.String)
+			if rhs.Int < 0 || len(runes) <= rhs.Int {
+				return ExpressionResult{}, &RuntimeError{Kind: IndexError, Message: "Cannot use % to get character " + strconv.Itoa(rhs.Int) + " of a string of length " + strconv.Itoa(len(runes))}
+			}
+			return ExpressionResult{String: string(runes[rhs.Int]), Type: String}, nil
 		case symbols.LTOperator:
 			return ExpressionResult{Bool: len(lhs.String) < rhs.Int, Type: Bool}, nil
 		default:
@@ -144,8 +185,14 @@ func executeBinaryOperatorOnInt(lhs ExpressionResult, rhs ExpressionResult, oper
 		case symbols.TimesOperator:
 			return ExpressionResult{Int: lhs.Int * rhs.Int, Type: Int}, nil
 		case symbols.DivideOperator:
+			if rhs.Int == 0 {
+				return ExpressionResult{}, &RuntimeError{Kind: DivideByZeroError, Message: "Cannot divide by zero"}
+			}
 			return ExpressionResult{Int: lhs.Int / rhs.Int, Type: Int}, nil
 		case symbols.ModuloOperator:
+			if rhs.Int == 0 {
+				return ExpressionResult{}, &RuntimeError{Kind: DivideByZeroError, Message: "Cannot use % with zero"}
+			}
 			return ExpressionResult{Int: lhs.Int % rhs.Int, Type: Int}, nil
 		default:
 			return ExpressionResult{}, errors.New("Cannot use '" + symbols.BinaryOperatorTypeNames[operatorType] + "' on two ints")
@@ -190,32 +237,74 @@ func executeBinaryOperatorOnBool(lhs ExpressionResult, rhs ExpressionResult, ope
 	return ExpressionResult{}, errors.New("RHS expression is of unrecognised type")
 }
 
-func evaluateBinaryOperator(expression ast.BinaryOperator, scope scope) (ExpressionResult, error) {
-	lhs, err := evaluateExpression(expression.Lhs, scope)
+func (interpreter *Interpreter) evaluateBinaryOperator(expression ast.BinaryOperator, scope scope) (ExpressionResult, error) {
+	lhs, err := interpreter.evaluateExpression(expression.Lhs, scope)
 
 	if err != nil {
-		log.Fatal(err)
+		return ExpressionResult{}, err
 	}
 
-	rhs, err := evaluateExpression(expression.Rhs, scope)
+	rhs, err := interpreter.evaluateExpression(expression.Rhs, scope)
 
 	if err != nil {
-		log.Fatal(err)
+		return ExpressionResult{}, err
 	}
 
+	return applyBinaryOperator(lhs, rhs, expression.BinaryOperatorType, expression.Pos)
+}
+
+// applyBinaryOperator picks the right operator helper for the type of lhs
+// pos is where the operator is in the source, for any error returned
+func applyBinaryOperator(lhs ExpressionResult, rhs ExpressionResult, operatorType symbols.BinaryOperatorType, pos symbols.Position) (ExpressionResult, error) {
+	var result ExpressionResult
+	var err error
 	switch lhs.Type {
 	case String:
-		return executeBinaryOperatorOnString(lhs, rhs, expression.BinaryOperatorType)
+		result, err = executeBinaryOperatorOnString(lhs, rhs, operatorType)
 	case Int:
-		return executeBinaryOperatorOnInt(lhs, rhs, expression.BinaryOperatorType)
+		result, err = executeBinaryOperatorOnInt(lhs, rhs, operatorType)
 	case Bool:
-		return executeBinaryOperatorOnBool(lhs, rhs, expression.BinaryOperatorType)
+		result, err = executeBinaryOperatorOnBool(lhs, rhs, operatorType)
+	default:
+		err = errors.New("LHS expression is of unrecognised type")
+	}
+
+	if err != nil {
+		// The operator helpers do not know where they are in the source, so fill that in here
+		if runtimeErr, ok := err.(*RuntimeError); ok {
+			runtimeErr.Pos = pos
+			return ExpressionResult{}, runtimeErr
+		}
+		return ExpressionResult{}, newRuntimeError(pos, TypeError, err.Error())
 	}
+	return result, nil
+}
 
-	return ExpressionResult{}, errors.New("LHS expression is of unrecognised type")
+// BinaryOperatorResultType works out the type an operator gives for operands of
+// two types without their values, or the TypeError it fails with at runtime
+func BinaryOperatorResultType(lhs ResultType, rhs ResultType, operatorType symbols.BinaryOperatorType) (ResultType, error) {
+	// values no operator fails on, so only the types can cause an error
+	sampleOf := func(resultType ResultType) ExpressionResult {
+		return ExpressionResult{String: "sample", Int: 1, Type: resultType}
+	}
+	result, err := applyBinaryOperator(sampleOf(lhs), sampleOf(rhs), operatorType, symbols.Position{})
+	return result.Type, err
 }
 
-func evaluateExpression(expression ast.Expression, scope scope) (ExpressionResult, error) {
+// evaluateHeapAddress evaluates the index of a HeapAccess, checking it is an Int
+func (interpreter *Interpreter) evaluateHeapAddress(heapAccess ast.HeapAccess, scope scope) (int, error) {
+	targetValue, err := interpreter.evaluateExpression(heapAccess.IndexExpression, scope)
+	if err != nil {
+		return 0, err
+	}
+
+	if targetValue.Type != Int {
+		return 0, newRuntimeError(heapAccess.Pos, TypeError, "tried to access the heap with value that is not an int")
+	}
+	return targetValue.Int, nil
+}
+
+func (interpreter *Interpreter) evaluateExpression(expression ast.Expression, scope scope) (ExpressionResult, error) {
 	switch expression := expression.(type) {
 	case ast.StringLiteral:
 		return ExpressionResult{
@@ -233,56 +322,60 @@ func evaluateExpression(expression ast.Expression, scope scope) (ExpressionResul
 			Bool: expression.Value,
 		}, nil
 	case ast.VariableName:
-		return getInScope(expression.Name, scope), nil
+		return getInScope(expression.Name, scope, expression.Pos)
 	case ast.HeapAccess:
-		targetValue, err := evaluateExpression(expression.IndexExpression, scope)
+		address, err := interpreter.evaluateHeapAddress(expression, scope)
 		if err != nil {
-			log.Fatal(err)
+			return ExpressionResult{}, err
 		}
-
-		if targetValue.Type != Int {
-			log.Fatal("tried to access the heap with value that is not an int")
-		}
-		return heap[targetValue.Int], nil
+		return interpreter.heap.read(address, expression.Pos)
 	case ast.BinaryOperator:
-		return evaluateBinaryOperator(expression, scope)
+		return interpreter.evaluateBinaryOperator(expression, scope)
 	}
-	return ExpressionResult{}, errors.New("tried to evaluate an unrecognised AST node")
+	return ExpressionResult{}, newRuntimeError(ast.PositionOf(expression), UnrecognisedNodeError, "tried to evaluate an unrecognised AST node")
 }
 
-func runPrint(print ast.Log, scope scope) {
-	result, err := evaluateExpression(print.Expr, scope)
+func (interpreter *Interpreter) runPrint(print ast.Log, scope scope) error {
+	result, err := interpreter.evaluateExpression(print.Expr, scope)
 
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
+	interpreter.print(result)
+	return nil
+}
+
+func (interpreter *Interpreter) print(result ExpressionResult) {
 	switch result.Type {
 	case String:
-		fmt.Print(result.String)
+		fmt.Fprint(interpreter.stdout, result.String)
 		break
 	case Int:
-		fmt.Print(result.Int)
+		fmt.Fprint(interpreter.stdout, result.Int)
 		break
 	}
 }
 
-func readRune() (rune, error) {
-	state, err := terminal.MakeRaw(int(os.Stdin.Fd()))
-	if err != nil {
-		return 0, err
+// assignToTarget writes a value into the Variable or HeapAccess target of a command
+func (interpreter *Interpreter) assignToTarget(target ast.Expression, val ExpressionResult, scope scope) error {
+	switch assignTarget := target.(type) {
+	case ast.VariableName:
+		return assignInScope(assignTarget.Name, val, scope, assignTarget.Pos)
+	case ast.HeapAccess:
+		address, err := interpreter.evaluateHeapAddress(assignTarget, scope)
+		if err != nil {
+			return err
+		}
+		return interpreter.heap.write(address, val, assignTarget.Pos)
 	}
-
-	r := bufio.NewReader(os.Stdin)
-	ru, _, err := r.ReadRune()
-	terminal.Restore(0, state)
-	return ru, err
+	return newRuntimeError(ast.PositionOf(target), UnrecognisedNodeError, "tried to assign to an unrecognised AST node")
 }
 
-func runRead(read ast.Read, scope scope) {
-	rawRune, err := readRune()
+func (interpreter *Interpreter) runRead(read ast.Read, scope scope) error {
+	rawRune, err := interpreter.readRune()
 	if err != nil {
-		log.Fatal(err)
+		return newRuntimeError(read.Pos, InputError, err.Error())
 	}
 
 	str := ExpressionResult{
@@ -290,191 +383,285 @@ func runRead(read ast.Read, scope scope) {
 		String: string(rawRune),
 	}
 
-	switch assignTarget := read.Target.(type) {
-	case ast.VariableName:
-		assignInScope(assignTarget.Name, str, scope)
-		break
-	case ast.HeapAccess:
-		targetValue, err := evaluateExpression(assignTarget.IndexExpression, scope)
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		if targetValue.Type != Int {
-			log.Fatal("tried to access the heap with value that is not an int")
-		}
-		heap[targetValue.Int] = str
-	}
+	return interpreter.assignToTarget(read.Target, str, scope)
 }
 
-func runAssign(assign ast.Assign, scope scope) {
-	result, err := evaluateExpression(assign.Expr, scope)
+func (interpreter *Interpreter) runAssign(assign ast.Assign, scope scope) error {
+	result, err := interpreter.evaluateExpression(assign.Expr, scope)
 
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	switch assignTarget := assign.Target.(type) {
-	case ast.VariableName:
-		assignInScope(assignTarget.Name, result, scope)
-		break
-	case ast.HeapAccess:
-		targetValue, err := evaluateExpression(assignTarget.IndexExpression, scope)
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		if targetValue.Type != Int {
-			log.Fatal("tried to access the heap with value that is not an int")
-		}
-		heap[targetValue.Int] = result
-	}
+	return interpreter.assignToTarget(assign.Target, result, scope)
 }
 
-func runDefine(define ast.New, scope scope) {
-	result, err := evaluateExpression(define.Expr, scope)
+func (interpreter *Interpreter) runDefine(define ast.New, scope scope) error {
+	result, err := interpreter.evaluateExpression(define.Expr, scope)
 
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	defineInScope(define.VariableName, result, scope)
+	return defineInScope(define.VariableName, result, scope, define.Pos)
 }
 
-func runIf(ifCommand ast.If, scope scope, programs programs) (ExpressionResult, bool, bool) {
-	result, err := evaluateExpression(ifCommand.Cond, scope)
+func (interpreter *Interpreter) runIf(ifCommand ast.If, scope scope) (controlSignal, error) {
+	result, err := interpreter.evaluateExpression(ifCommand.Cond, scope)
 	if err != nil {
-		log.Fatal(err)
+		return controlSignal{}, err
 	}
 
 	if result.Type != Bool {
-		log.Fatal("If condition did not evaluate to a boolean")
+		return controlSignal{}, newRuntimeError(ifCommand.Pos, TypeError, "If condition did not evaluate to a boolean")
 	}
+	interpreter.options.Coverage.branch(ifCommand.Pos, result.Bool)
 
 	if result.Bool {
-		return ExecuteBlock(ifCommand.Commands, scope, programs)
+		return interpreter.executeBlock(ifCommand.Commands, scope)
+	}
+
+	for _, elseIf := range ifCommand.ElseIfs {
+		result, err := interpreter.evaluateExpression(elseIf.Cond, scope)
+		if err != nil {
+			return controlSignal{}, err
+		}
+
+		if result.Type != Bool {
+			return controlSignal{}, newRuntimeError(elseIf.Pos, TypeError, "Elif condition did not evaluate to a boolean")
+		}
+		interpreter.options.Coverage.branch(elseIf.Pos, result.Bool)
+
+		if result.Bool {
+			return interpreter.executeBlock(elseIf.Commands, scope)
+		}
 	}
-	return ExpressionResult{}, false, false
+
+	if ifCommand.HasElse {
+		return interpreter.executeBlock(ifCommand.Else.Commands, scope)
+	}
+	return controlSignal{}, nil
 }
 
-func runWhile(whileCommand ast.While, scope scope, programs programs) (ExpressionResult, bool, bool) {
+func (interpreter *Interpreter) runWhile(whileCommand ast.While, scope scope) (controlSignal, error) {
 	for {
-		result, err := evaluateExpression(whileCommand.Cond, scope)
+		result, err := interpreter.evaluateExpression(whileCommand.Cond, scope)
 		if err != nil {
-			log.Fatal(err)
+			return controlSignal{}, err
 		}
 
 		if result.Type != Bool {
-			log.Fatal("If condition did not evaluate to a boolean")
+			return controlSignal{}, newRuntimeError(whileCommand.Pos, TypeError, "While condition did not evaluate to a boolean")
 		}
+		interpreter.options.Coverage.branch(whileCommand.Pos, result.Bool)
 
-		if result.Bool {
-			val, didReturn, hasVal := ExecuteBlock(whileCommand.Commands, scope, programs)
-			if didReturn {
-				return val, didReturn, hasVal
-			}
-		} else {
-			return ExpressionResult{}, false, false
+		if !result.Bool {
+			return controlSignal{}, nil
+		}
+
+		signal, err := interpreter.executeBlock(whileCommand.Commands, scope)
+		if err != nil {
+			return controlSignal{}, err
+		}
+		switch signal.kind {
+		case returnSignal:
+			return signal, nil
+		case breakSignal:
+			return controlSignal{}, nil
 		}
 	}
 }
 
-func runProgram(programCommand ast.Program, programs programs) {
-	programs[programCommand.Name.Name] = programCommand
+func (interpreter *Interpreter) runProgram(programCommand ast.Program) error {
+	if err := interpreter.checkNotHostProgram(programCommand.Name.Name, programCommand.Pos); err != nil {
+		return err
+	}
+	interpreter.programs[programCommand.Name.Name] = programCommand
+	return nil
+}
+
+// runHostCall calls a HostProgram with the arguments of a call command
+func (interpreter *Interpreter) runHostCall(program *hostProgram, callCommand ast.Call, upperScope scope) error {
+	if len(callCommand.Expressions) != len(program.parameterNames) {
+		return newRuntimeError(callCommand.Pos, ArgumentCountError, "Tried to call "+callCommand.Name.Name+" with "+fmt.Sprint(len(callCommand.Expressions))+" But it expects "+fmt.Sprint(len(program.parameterNames))+" parameters")
+	}
+
+	args := make([]Value, 0, len(callCommand.Expressions))
+	for _, expression := range callCommand.Expressions {
+		val, err := interpreter.evaluateExpression(expression, upperScope)
+		if err != nil {
+			return err
+		}
+		args = append(args, val)
+	}
+	val, err := interpreter.runHostProgram(program, args, callCommand.Pos)
+	if err != nil {
+		return err
+	}
+	if callCommand.HasReturnTarget {
+		return assignInScope(callCommand.ReturnTarget.Name, val, upperScope, callCommand.ReturnTarget.Pos)
+	}
+	return nil
 }
 
-func runCall(callCommand ast.Call, upperScope scope, programs programs) {
-	program, ok := programs[callCommand.Name.Name]
+func (interpreter *Interpreter) runCall(callCommand ast.Call, upperScope scope) error {
+	program, ok := interpreter.programs[callCommand.Name.Name]
 
+	if hostProgram, isHost := interpreter.hostPrograms[callCommand.Name.Name]; !ok && isHost {
+		return interpreter.runHostCall(hostProgram, callCommand, upperScope)
+	}
 	if !ok {
-		log.Fatal("Tried to call " + callCommand.Name.Name + " but it has not been created")
+		return newRuntimeError(callCommand.Pos, UndefinedProgramError, "Tried to call "+callCommand.Name.Name+" but it has not been created")
 	}
 
 	if len(callCommand.Expressions) != len(program.Parameters) {
-		log.Fatal("Tried to call " + callCommand.Name.Name + " with " + fmt.Sprint(len(callCommand.Expressions)) + " But it expects " + fmt.Sprint(len(program.Parameters)) + " parameters")
+		return newRuntimeError(callCommand.Pos, ArgumentCountError, "Tried to call "+callCommand.Name.Name+" with "+fmt.Sprint(len(callCommand.Expressions))+" But it expects "+fmt.Sprint(len(program.Parameters))+" parameters")
 	}
 
 	scope := scope{
 		{},
 	}
 
+	args := make([]ExpressionResult, 0, len(program.Parameters))
 	for i, parameter := range program.Parameters {
-		val, err := evaluateExpression(callCommand.Expressions[i], upperScope)
+		val, err := interpreter.evaluateExpression(callCommand.Expressions[i], upperScope)
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
-		defineInScope(parameter.Name, val, scope)
+		err = defineInScope(parameter.Name, val, scope, parameter.Pos)
+		if err != nil {
+			return err
+		}
+		args = append(args, val)
+	}
+	if err := interpreter.checkCallDepth(len(interpreter.callStack), callCommand.Pos, interpreter.runningProgram()); err != nil {
+		return err
+	}
+	interpreter.callStack = append(interpreter.callStack, CallFrame{Program: callCommand.Name.Name, Pos: callCommand.Pos, Arguments: args, callerScope: upperScope})
+	interpreter.enterProgram(program.Name.Name, program.Pos, callCommand.Pos)
+	signal, err := interpreter.executeBlock(program.Commands, scope)
+	interpreter.exitProgram()
+	if err == nil {
+		err = strayControlSignalError(signal)
 	}
-	val, _, hasVal := ExecuteBlock(program.Commands, scope, programs)
-	if hasVal {
+	if err != nil {
+		err = interpreter.traceError(err)
+	}
+	interpreter.callStack = interpreter.callStack[:len(interpreter.callStack)-1]
+	if err != nil {
+		return err
+	}
+	if signal.hasValue {
 		if callCommand.HasReturnTarget {
-			assignInScope(callCommand.ReturnTarget.Name, val, upperScope)
+			return assignInScope(callCommand.ReturnTarget.Name, signal.value, upperScope, callCommand.ReturnTarget.Pos)
 		}
 	}
+	return nil
 }
 
-func runReturn(returnCommand ast.Return, scope scope) (ExpressionResult, bool, bool) {
+func (interpreter *Interpreter) runReturn(returnCommand ast.Return, scope scope) (controlSignal, error) {
 
 	if returnCommand.HasExpression {
-		result, err := evaluateExpression(returnCommand.Expression, scope)
+		result, err := interpreter.evaluateExpression(returnCommand.Expression, scope)
 
 		if err != nil {
-			log.Fatal(err)
+			return controlSignal{}, err
 		}
 
-		return result, true, true
+		return controlSignal{kind: returnSignal, value: result, hasValue: true, pos: returnCommand.Pos}, nil
+	}
+
+	return controlSignal{kind: returnSignal, pos: returnCommand.Pos}, nil
+}
+
+// assertionFailed is the error for an assert whose condition was false
+func assertionFailed(pos symbols.Position, message ExpressionResult, hasMessage bool) error {
+	if !hasMessage {
+		return newRuntimeError(pos, AssertionError, "Assertion failed")
+	}
+	text := message.String
+	if message.Type != String {
+		text = message.Literal()
+	}
+	return newRuntimeError(pos, AssertionError, "Assertion failed: "+text)
+}
+
+// runAssert only evaluates the message if the condition is false
+func (interpreter *Interpreter) runAssert(assert ast.Assert, scope scope) error {
+	result, err := interpreter.evaluateExpression(assert.Cond, scope)
+	if err != nil {
+		return err
+	}
+	if result.Type != Bool {
+		return newRuntimeError(assert.Pos, TypeError, "Assert condition did not evaluate to a boolean")
+	}
+	if result.Bool {
+		return nil
 	}
 
-	return ExpressionResult{}, true, false
+	message := ExpressionResult{}
+	if assert.HasMessage {
+		message, err = interpreter.evaluateExpression(assert.Message, scope)
+		if err != nil {
+			return err
+		}
+	}
+	return assertionFailed(assert.Pos, message, assert.HasMessage)
 }
 
-func runCommand(command ast.Command, scope scope, programs programs) (ExpressionResult, bool, bool) {
+func (interpreter *Interpreter) runCommand(command ast.Command, scope scope) (controlSignal, error) {
+	if interpreter.options.hasStepLimits() {
+		if err := interpreter.step(ast.PositionOf(command), interpreter.runningProgram()); err != nil {
+			return controlSignal{}, err
+		}
+	}
+	interpreter.options.Coverage.ran(ast.PositionOf(command))
+	interpreter.options.Profile.hit(ast.PositionOf(command))
+	if interpreter.options.Hook != nil {
+		if err := interpreter.options.Hook(Step{Command: command, scope: scope, interpreter: interpreter}); err != nil {
+			return controlSignal{}, err
+		}
+	}
+
+	var err error
 	switch command := command.(type) {
 	case ast.Log:
-		runPrint(command, scope)
+		err = interpreter.runPrint(command, scope)
 	case ast.Read:
-		runRead(command, scope)
+		err = interpreter.runRead(command, scope)
 	case ast.Assign:
-		runAssign(command, scope)
+		err = interpreter.runAssign(command, scope)
 	case ast.New:
-		runDefine(command, scope)
+		err = interpreter.runDefine(command, scope)
 	case ast.If:
-		val, didReturn, hasVal := runIf(command, scope, programs)
-		if didReturn {
-			return val, didReturn, hasVal
-		}
+		return interpreter.runIf(command, scope)
 	case ast.While:
-		val, didReturn, hasVal := runWhile(command, scope, programs)
-		if didReturn {
-			return val, didReturn, hasVal
-		}
+		return interpreter.runWhile(command, scope)
 	case ast.Program:
-		runProgram(command, programs)
+		err = interpreter.runProgram(command)
 	case ast.Call:
-		runCall(command, scope, programs)
+		err = interpreter.runCall(command, scope)
 	case ast.Return:
-		return runReturn(command, scope)
+		return interpreter.runReturn(command, scope)
+	case ast.Break:
+		return controlSignal{kind: breakSignal, pos: command.Pos}, nil
+	case ast.Continue:
+		return controlSignal{kind: continueSignal, pos: command.Pos}, nil
+	case ast.Assert:
+		err = interpreter.runAssert(command, scope)
 	default:
-		log.Fatal("Unrecognised command")
+		err = newRuntimeError(ast.PositionOf(command), UnrecognisedNodeError, "Unrecognised command")
 	}
-	return ExpressionResult{}, false, false
+	return controlSignal{}, err
 }
 
-func ExecuteBlock(program []ast.Command, scope scope, programs programs) (ExpressionResult, bool, bool) {
+func (interpreter *Interpreter) executeBlock(program []ast.Command, scope scope) (controlSignal, error) {
 	scope = addScope(scope)
 	for _, command := range program {
-		val, didReturn, hasVal := runCommand(command, scope, programs)
-		if didReturn {
-			return val, didReturn, hasVal
+		signal, err := interpreter.runCommand(command, scope)
+		if signal.kind != noSignal || err != nil {
+			return signal, err
 		}
 	}
-	return ExpressionResult{}, false, false
-}
-
-func ExecuteProgram(program []ast.Command) {
-	programs := make(programs)
-	scope := scope{
-		{},
-	}
-	ExecuteBlock(program, scope, programs)
+	return controlSignal{}, nil
 }
@@ -0,0 +1,83 @@
+package executor
+
+import (
+	"fmt"
+	"morklerork/symbols"
+)
+
+// heap is the memory HeapAccess reads and writes. The cells it was created
+// with are allocated up front. A growable heap keeps cells written past them
+// in overflow instead, so a large address does not need every cell below it
+type heap struct {
+	cells    []ExpressionResult
+	growable bool
+	overflow map[int]ExpressionResult
+	// size is the number of addresses that can be read, from 0 up
+	size int
+}
+
+func newHeap(size int, growable bool) heap {
+	if size < 0 {
+		size = 0
+	}
+	return heap{
+		cells:    make([]ExpressionResult, size),
+		growable: growable,
+		overflow: make(map[int]ExpressionResult),
+		size:     size,
+	}
+}
+
+// outOfBounds is the error for a read or write of an address the heap does not have
+func (heap *heap) outOfBounds(address int, access string, pos symbols.Position) error {
+	if address < 0 {
+		return newRuntimeError(pos, IndexError, fmt.Sprintf("Tried to %s heap address %d, but heap addresses start at 0", access, address))
+	}
+	return newRuntimeError(pos, IndexError, fmt.Sprintf("Tried to %s heap address %d, but the heap only has %d cells, from 0 to %d", access, address, heap.size, heap.size-1))
+}
+
+// read finds the value at address, cells that have never been written hold an empty string
+func (heap *heap) read(address int, pos symbols.Position) (ExpressionResult, error) {
+	if address < 0 || address >= heap.size {
+		return ExpressionResult{}, heap.outOfBounds(address, "read", pos)
+	}
+	if address < len(heap.cells) {
+		return heap.cells[address], nil
+	}
+	return heap.overflow[address], nil
+}
+
+// write stores a value at address, growing a growable heap to fit it
+func (heap *heap) write(address int, val ExpressionResult, pos symbols.Position) error {
+	if address >= 0 && address < len(heap.cells) {
+		heap.cells[address] = val
+		return nil
+	}
+	if address < 0 || !heap.growable {
+		return heap.outOfBounds(address, "write", pos)
+	}
+	heap.overflow[address] = val
+	if address >= heap.size {
+		heap.size = address + 1
+	}
+	return nil
+}
+
+// builtinPrograms are the HostPrograms every Interpreter starts with
+var builtinPrograms = []ProgramSignature{
+	{Name: "$sys$heapSize"},
+}
+
+// BuiltinPrograms lists the programs every Interpreter starts with, so tools
+// that check calls without running them know they exist
+func BuiltinPrograms() []ProgramSignature {
+	return append([]ProgramSignature{}, builtinPrograms...)
+}
+
+// registerBuiltins registers the builtinPrograms
+func (interpreter *Interpreter) registerBuiltins() {
+	// $sys$heapSize is how many cells the heap has, it grows as a growable heap is written to
+	interpreter.RegisterProgram("$sys$heapSize", func(args []Value) (Value, error) {
+		return Value{Type: Int, Int: interpreter.heap.size}, nil
+	})
+}
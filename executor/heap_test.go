@@ -0,0 +1,37 @@
+package executor
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNegativeHeapSizeIsEmpty(t *testing.T) {
+	for _, engine := range engines {
+		t.Run(engine.name, func(t *testing.T) {
+			var output bytes.Buffer
+			interpreter := NewInterpreter(strings.NewReader(""), &output, -1, engine.options)
+			if size := interpreter.HeapSize(); size != 0 {
+				t.Errorf("expected a heap of 0 cells, got %d", size)
+			}
+			err := interpreter.Execute(parse(t, "= [0] 1\n"))
+			var runtimeErr *RuntimeError
+			if !errors.As(err, &runtimeErr) || runtimeErr.Kind != IndexError {
+				t.Errorf("expected an IndexError writing to an empty heap, got %v", err)
+			}
+		})
+	}
+}
+
+func TestGrowableHeapGrowsFromNegativeSize(t *testing.T) {
+	options := Options{GrowableHeap: true}
+	var output bytes.Buffer
+	interpreter := NewInterpreter(strings.NewReader(""), &output, -5, options)
+	if err := interpreter.Execute(parse(t, "= [3] 'x'\nlog [3]\n")); err != nil {
+		t.Fatal(err)
+	}
+	if output.String() != "x" || interpreter.HeapSize() != 4 {
+		t.Errorf("expected the heap to grow to 4 cells and log x, got %d cells and %q", interpreter.HeapSize(), output.String())
+	}
+}
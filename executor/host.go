@@ -0,0 +1,70 @@
+package executor
+
+import (
+	"errors"
+	"fmt"
+	"morklerork/symbols"
+	"strings"
+)
+
+// Value is a MorkleRork value, as given to and returned by a HostProgram
+type Value = ExpressionResult
+
+// HostProgram is a program written in go. It is given one argument for each
+// parameter it was registered with, and always returns a value, which is
+// stored in the return target of the call if it has one.
+// An error from a HostProgram stops the MorkleRork program with a HostError
+type HostProgram func(args []Value) (Value, error)
+
+type hostProgram struct {
+	name           string
+	parameterNames []string
+	run            HostProgram
+}
+
+// RegisterProgram makes a go function callable as a MorkleRork program with
+// `call`. name must be a program name, such as `$sys$now`, and the program
+// takes one argument for each of parameters, which are only used to describe
+// it. Registering a HostProgram replaces a program with the same name, but
+// a program command with the name of a HostProgram is a RuntimeError, so a
+// script cannot replace the programs its host gives it, such as $sys$heapSize
+func (interpreter *Interpreter) RegisterProgram(name string, program HostProgram, parameters ...string) error {
+	if len(name) < 2 || name[0] != '$' || strings.ContainsAny(name, " \t\n") {
+		return errors.New(name + " is not a program name, it must start with $")
+	}
+	delete(interpreter.programs, name)
+	delete(interpreter.compiledPrograms, name)
+	interpreter.hostPrograms[name] = &hostProgram{
+		name:           name,
+		parameterNames: append([]string{}, parameters...),
+		run:            program,
+	}
+	return nil
+}
+
+// checkNotHostProgram stops a program command from replacing a HostProgram
+func (interpreter *Interpreter) checkNotHostProgram(name string, pos symbols.Position) error {
+	if _, isHost := interpreter.hostPrograms[name]; isHost {
+		return newRuntimeError(pos, RedefinedProgramError, "Program "+name+" is given by the host, a program command cannot replace it")
+	}
+	return nil
+}
+
+// runHostProgram calls a HostProgram, wrapping any error it returns so it is
+// reported at the call
+func (interpreter *Interpreter) runHostProgram(program *hostProgram, args []Value, pos symbols.Position) (Value, error) {
+	interpreter.enterProgram(program.name, symbols.Position{}, pos)
+	result, err := program.run(args)
+	interpreter.exitProgram()
+	if err != nil {
+		var runtimeErr *RuntimeError
+		if errors.As(err, &runtimeErr) {
+			return Value{}, err
+		}
+		return Value{}, newRuntimeError(pos, HostError, program.name+" failed: "+err.Error())
+	}
+	if result.Type != String && result.Type != Int && result.Type != Bool {
+		return Value{}, newRuntimeError(pos, HostError, program.name+" returned a value of unknown type "+fmt.Sprint(int(result.Type)))
+	}
+	return result, nil
+}
@@ -0,0 +1,59 @@
+package executor
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestProgramCannotReplaceHostProgram(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		err    string
+	}{
+		{
+			name: "a builtin",
+			source: `program $sys$heapSize
+    return 5
+`,
+			err: "test.mr:1:1: Program $sys$heapSize is given by the host, a program command cannot replace it",
+		},
+		{
+			name: "a registered program",
+			source: `new :x 1
+if ?true
+    program $host$double :n
+        return :n
+`,
+			err: "test.mr:3:5: Program $host$double is given by the host, a program command cannot replace it",
+		},
+	}
+	for _, test := range tests {
+		for _, engine := range engines {
+			t.Run(test.name+"/"+engine.name, func(t *testing.T) {
+				var output bytes.Buffer
+				interpreter := NewInterpreter(strings.NewReader(""), &output, DefaultHeapSize, engine.options)
+				interpreter.RegisterProgram("$host$double", func(args []Value) (Value, error) {
+					return Value{Type: Int, Int: args[0].Int * 2}, nil
+				}, ":n")
+
+				err := interpreter.Execute(parse(t, test.source))
+				var runtimeErr *RuntimeError
+				if !errors.As(err, &runtimeErr) || runtimeErr.Kind != RedefinedProgramError {
+					t.Fatalf("expected a RedefinedProgramError, got %v", err)
+				}
+				if err.Error() != test.err {
+					t.Errorf("expected %q, got %q", test.err, err.Error())
+				}
+
+				// the host program is still the one that runs
+				err = interpreter.Execute(parse(t, "new :size 0\ncall :size $host$double 4\nlog :size\n"))
+				if err != nil || output.String() != "8" {
+					t.Errorf("expected the host program to still double, got %q %v", output.String(), err)
+				}
+			})
+		}
+	}
+}
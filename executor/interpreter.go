@@ -0,0 +1,244 @@
+package executor
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"golang.org/x/crypto/ssh/terminal"
+	"io"
+	"morklerork/ast"
+	"morklerork/symbols"
+	"os"
+	"sort"
+	"time"
+)
+
+// DefaultHeapSize is the number of heap cells the CLI gives to a program
+const DefaultHeapSize = 10000
+
+// Options changes how an Interpreter interacts with the host
+type Options struct {
+	// RawTerminal puts stdin into raw mode for each read, when stdin is a terminal,
+	// so that `read` receives every key press without waiting for enter
+	RawTerminal bool
+	// TreeWalker executes the ast directly instead of compiling it to bytecode first,
+	// it is slower, but useful for comparing the two engines
+	TreeWalker bool
+	// Hook is called before every command runs, with where the program has got to.
+	// An error from Hook stops the program with that error.
+	// Only the tree walker can call Hook, so setting it implies TreeWalker
+	Hook func(step Step) error
+	// GrowableHeap lets a program write to heap addresses past the heapSize
+	// the Interpreter was created with, growing the heap to fit them
+	GrowableHeap bool
+	// Coverage, if set, records which commands run and which way each condition goes
+	Coverage *Coverage
+	// Profile, if set, records how many times each program is called and how long it runs
+	Profile *Profile
+
+	// MaxSteps stops a run with a LimitError once it has run this many commands
+	MaxSteps int
+	// MaxCallDepth stops a run with a LimitError when a call would make more
+	// than this many programs run at once, it is DefaultMaxCallDepth if it is 0
+	MaxCallDepth int
+	// Timeout stops a run with a LimitError once it has run for this long
+	Timeout time.Duration
+	// Context stops a run with a LimitError once it is cancelled
+	Context context.Context
+	// any other limit of 0 is no limit. A run is one call to Execute, Evaluate or Call.
+	// A read waiting for input is not stopped by Timeout or Context
+}
+
+// Interpreter owns everything a running MorkleRork program can see or change,
+// so that many programs can run side by side in one process
+type Interpreter struct {
+	stdin       *bufio.Reader
+	stdinFile   *os.File
+	stdout      io.Writer
+	options     Options
+	heap        heap
+	programs    programs
+	globalScope scope
+	// programs written in go, see RegisterProgram. Both engines share them
+	hostPrograms map[string]*hostProgram
+
+	// the programs the tree walker is running, outermost first
+	callStack []CallFrame
+
+	// state for the limits in Options, see limits.go
+	running  int
+	steps    int
+	deadline time.Time
+
+	// the calls Options.Profile is timing, innermost last, see profile.go
+	profileStack []activation
+
+	// state for the bytecode engine, see compile.go and vm.go
+	compiledPrograms map[string]*compiledProgram
+	globalNames      *globalTable
+	globals          []globalVariable
+}
+
+// NewInterpreter creates an Interpreter reading `read` input from stdin and
+// writing `log` output to stdout, with a heap of heapSize cells.
+// A negative heapSize is treated as 0, a heap with no cells
+func NewInterpreter(stdin io.Reader, stdout io.Writer, heapSize int, options Options) *Interpreter {
+	interpreter := &Interpreter{
+		stdin:        bufio.NewReader(stdin),
+		stdout:       stdout,
+		options:      options,
+		heap:         newHeap(heapSize, options.GrowableHeap),
+		programs:     make(programs),
+		hostPrograms: make(map[string]*hostProgram),
+		globalScope: scope{
+			{},
+		},
+		compiledPrograms: make(map[string]*compiledProgram),
+		globalNames: &globalTable{
+			indexes: make(map[string]int),
+		},
+	}
+
+	interpreter.registerBuiltins()
+
+	// raw mode only makes sense if stdin is a real terminal
+	if file, ok := stdin.(*os.File); ok && terminal.IsTerminal(int(file.Fd())) {
+		interpreter.stdinFile = file
+	}
+
+	return interpreter
+}
+
+func (interpreter *Interpreter) usesTreeWalker() bool {
+	return interpreter.options.TreeWalker || interpreter.options.Hook != nil
+}
+
+func (interpreter *Interpreter) readRune() (rune, error) {
+	if interpreter.options.RawTerminal && interpreter.stdinFile != nil {
+		fd := int(interpreter.stdinFile.Fd())
+		state, err := terminal.MakeRaw(fd)
+		if err != nil {
+			return 0, err
+		}
+		defer terminal.Restore(fd, state)
+	}
+
+	ru, _, err := interpreter.stdin.ReadRune()
+	return ru, err
+}
+
+// Execute runs a program in the Interpreter's global scope, stopping at the first RuntimeError
+// Programs and variables defined by earlier calls to Execute are visible to later ones
+func (interpreter *Interpreter) Execute(program []ast.Command) error {
+	interpreter.beginRun()
+	defer interpreter.endRun()
+	if interpreter.options.Coverage != nil {
+		interpreter.options.Coverage.add(program)
+	}
+
+	if !interpreter.usesTreeWalker() {
+		_, err := interpreter.runChunk(interpreter.compileTopLevel(program))
+		return err
+	}
+
+	for _, command := range program {
+		signal, err := interpreter.runCommand(command, interpreter.globalScope)
+		if err != nil {
+			return err
+		}
+		if signal.kind != noSignal {
+			return strayControlSignalError(signal)
+		}
+	}
+	return nil
+}
+
+// Evaluate works out the value of an expression in the Interpreter's global scope
+func (interpreter *Interpreter) Evaluate(expression ast.Expression) (ExpressionResult, error) {
+	interpreter.beginRun()
+	defer interpreter.endRun()
+
+	if !interpreter.usesTreeWalker() {
+		evaluate := ast.Return{Pos: ast.PositionOf(expression), Expression: expression, HasExpression: true}
+		return interpreter.runChunk(interpreter.compileTopLevel([]ast.Command{evaluate}))
+	}
+	return interpreter.evaluateExpression(expression, interpreter.globalScope)
+}
+
+// Variable is a global variable and its current value
+type Variable struct {
+	Name  string
+	Value ExpressionResult
+}
+
+// Variables lists every global variable, sorted by name
+func (interpreter *Interpreter) Variables() []Variable {
+	variables := make([]Variable, 0)
+	if !interpreter.usesTreeWalker() {
+		for index, name := range interpreter.globalNames.names {
+			if global := interpreter.global(index); global.defined {
+				variables = append(variables, Variable{Name: name, Value: global.value})
+			}
+		}
+	} else {
+		for name, value := range interpreter.globalScope[0] {
+			variables = append(variables, Variable{Name: name, Value: value})
+		}
+	}
+	sort.Slice(variables, func(i, j int) bool {
+		return variables[i].Name < variables[j].Name
+	})
+	return variables
+}
+
+// ProgramSignature is the name of a program that can be called, and the names of its parameters
+type ProgramSignature struct {
+	Name       string
+	Parameters []string
+}
+
+// Programs lists every program that has been created or registered, sorted by name
+func (interpreter *Interpreter) Programs() []ProgramSignature {
+	signatures := make([]ProgramSignature, 0)
+	if !interpreter.usesTreeWalker() {
+		for name, program := range interpreter.compiledPrograms {
+			signatures = append(signatures, ProgramSignature{Name: name, Parameters: program.parameterNames})
+		}
+	} else {
+		for name, program := range interpreter.programs {
+			parameters := make([]string, 0, len(program.Parameters))
+			for _, parameter := range program.Parameters {
+				parameters = append(parameters, parameter.Name)
+			}
+			signatures = append(signatures, ProgramSignature{Name: name, Parameters: parameters})
+		}
+	}
+	for name, program := range interpreter.hostPrograms {
+		signatures = append(signatures, ProgramSignature{Name: name, Parameters: program.parameterNames})
+	}
+	sort.Slice(signatures, func(i, j int) bool {
+		return signatures[i].Name < signatures[j].Name
+	})
+	return signatures
+}
+
+// HeapSize is the number of cells in the Interpreter's heap, a growable heap
+// grows as it is written to
+func (interpreter *Interpreter) HeapSize() int {
+	return interpreter.heap.size
+}
+
+// HeapCell reads one cell of the heap, which must be between 0 and HeapSize
+func (interpreter *Interpreter) HeapCell(address int) (ExpressionResult, error) {
+	if address < 0 || address >= interpreter.heap.size {
+		return ExpressionResult{}, fmt.Errorf("heap address %d is outside of the heap, which has %d cells", address, interpreter.heap.size)
+	}
+	return interpreter.heap.read(address, symbols.Position{})
+}
+
+// ExecuteProgram runs a whole program against the process's stdin and stdout
+// with a DefaultHeapSize heap, stopping at the first RuntimeError
+func ExecuteProgram(program []ast.Command, treeWalker bool) error {
+	interpreter := NewInterpreter(os.Stdin, os.Stdout, DefaultHeapSize, Options{RawTerminal: true, TreeWalker: treeWalker})
+	return interpreter.Execute(program)
+}
@@ -0,0 +1,88 @@
+package executor
+
+import (
+	"fmt"
+	"morklerork/symbols"
+	"time"
+)
+
+// checkInterval is how many commands run between checks of Options.Timeout
+// and Options.Context, as reading the clock for every command is slow
+const checkInterval = 1024
+
+// DefaultMaxCallDepth is the MaxCallDepth when Options does not give one.
+// The tree walker uses the go stack for every call, so without a limit
+// runaway recursion would crash the whole process instead of the program.
+// Both engines use it, so a program stops at the same call on either
+const DefaultMaxCallDepth = 10000
+
+func (options Options) hasStepLimits() bool {
+	return options.MaxSteps > 0 || options.Timeout > 0 || options.Context != nil
+}
+
+// beginRun starts counting towards the limits in Options again, unless a run
+// is already going, such as when a HostProgram uses Call
+func (interpreter *Interpreter) beginRun() {
+	if interpreter.running == 0 {
+		interpreter.steps = 0
+		if interpreter.options.Timeout > 0 {
+			interpreter.deadline = time.Now().Add(interpreter.options.Timeout)
+		}
+		interpreter.enterProgram(TopLevel, symbols.Position{}, symbols.Position{})
+	}
+	interpreter.running++
+}
+
+func (interpreter *Interpreter) endRun() {
+	interpreter.running--
+	if interpreter.running == 0 {
+		interpreter.unwindProfile(0)
+	}
+}
+
+// runningProgram is the name of the program the tree walker is running, "" at the top level
+func (interpreter *Interpreter) runningProgram() string {
+	if len(interpreter.callStack) == 0 {
+		return ""
+	}
+	return interpreter.callStack[len(interpreter.callStack)-1].Program
+}
+
+func limitError(pos symbols.Position, program string, message string) error {
+	if program == "" {
+		return newRuntimeError(pos, LimitError, message+", at the top level")
+	}
+	return newRuntimeError(pos, LimitError, message+", in "+program)
+}
+
+// step counts one command, checking it does not go over a limit
+func (interpreter *Interpreter) step(pos symbols.Position, program string) error {
+	interpreter.steps++
+	options := interpreter.options
+	if options.MaxSteps > 0 && interpreter.steps > options.MaxSteps {
+		return limitError(pos, program, fmt.Sprintf("Stopped after running %d commands, the MaxSteps limit", options.MaxSteps))
+	}
+	if interpreter.steps%checkInterval != 0 {
+		return nil
+	}
+	if options.Timeout > 0 && time.Now().After(interpreter.deadline) {
+		return limitError(pos, program, "Stopped after running for "+options.Timeout.String()+", the Timeout limit")
+	}
+	if options.Context != nil && options.Context.Err() != nil {
+		return limitError(pos, program, "Stopped as the Context is done: "+options.Context.Err().Error())
+	}
+	return nil
+}
+
+// checkCallDepth checks a call made while depth programs are running does not
+// go over Options.MaxCallDepth
+func (interpreter *Interpreter) checkCallDepth(depth int, pos symbols.Position, program string) error {
+	max := interpreter.options.MaxCallDepth
+	if max <= 0 {
+		max = DefaultMaxCallDepth
+	}
+	if depth >= max {
+		return limitError(pos, program, fmt.Sprintf("Stopped a call that would run more than %d programs at once, the MaxCallDepth limit", max))
+	}
+	return nil
+}
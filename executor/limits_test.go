@@ -0,0 +1,146 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"morklerork/ast"
+	"morklerork/lexer"
+	"morklerork/parser"
+	"strings"
+	"testing"
+	"time"
+)
+
+// engines are the two ways an Interpreter can run a program, which must behave the same
+var engines = []struct {
+	name    string
+	options Options
+}{
+	{"bytecode", Options{}},
+	{"treewalker", Options{TreeWalker: true}},
+}
+
+func parse(t *testing.T, source string) []ast.Command {
+	t.Helper()
+	fileSymbols, err := lexer.Lex("test.mr", source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commands, _, err := parser.ParseBlock(fileSymbols, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return commands
+}
+
+// run executes source in a new Interpreter, returning what it logged and the error it stopped with
+func run(t *testing.T, source string, options Options) (string, error) {
+	t.Helper()
+	var output bytes.Buffer
+	interpreter := NewInterpreter(strings.NewReader(""), &output, DefaultHeapSize, options)
+	err := interpreter.Execute(parse(t, source))
+	return output.String(), err
+}
+
+func TestRunawayRecursionStopsWithLimitError(t *testing.T) {
+	source := `program $f :n
+    new :x 0
+    call :x $f (:n + 1)
+    return :x
+
+call $f 1
+`
+	for _, engine := range engines {
+		t.Run(engine.name, func(t *testing.T) {
+			_, err := run(t, source, engine.options)
+			var runtimeErr *RuntimeError
+			if !errors.As(err, &runtimeErr) || runtimeErr.Kind != LimitError {
+				t.Fatalf("expected a LimitError, got %v", err)
+			}
+			if !strings.Contains(runtimeErr.Message, "more than 10000 programs") {
+				t.Errorf("expected the default call depth in the error, got %q", runtimeErr.Message)
+			}
+			if len(runtimeErr.Trace) != DefaultMaxCallDepth {
+				t.Errorf("expected a trace of %d calls, got %d", DefaultMaxCallDepth, len(runtimeErr.Trace))
+			}
+		})
+	}
+}
+
+func TestMaxCallDepthOption(t *testing.T) {
+	source := `program $f :n
+    call $f (:n + 1)
+
+call $f 1
+`
+	for _, engine := range engines {
+		t.Run(engine.name, func(t *testing.T) {
+			options := engine.options
+			options.MaxCallDepth = 5
+			_, err := run(t, source, options)
+			if err == nil || !strings.Contains(err.Error(), "more than 5 programs") {
+				t.Errorf("expected the call depth of 5 to stop the program, got %v", err)
+			}
+		})
+	}
+}
+
+func TestLimitsStopTheRunningProgram(t *testing.T) {
+	source := `program $spin
+    new :i 0
+    while ?true
+        = :i :i + 1
+
+call $spin
+`
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		name    string
+		options Options
+		message string
+	}{
+		{"MaxSteps", Options{MaxSteps: 50}, "Stopped after running 50 commands, the MaxSteps limit, in $spin"},
+		{"Timeout", Options{Timeout: time.Millisecond}, "Stopped after running for 1ms, the Timeout limit, in $spin"},
+		{"Context", Options{Context: cancelled}, "Stopped as the Context is done: context canceled, in $spin"},
+	}
+	for _, test := range tests {
+		for _, engine := range engines {
+			t.Run(test.name+"/"+engine.name, func(t *testing.T) {
+				options := test.options
+				options.TreeWalker = engine.options.TreeWalker
+				_, err := run(t, source, options)
+				var runtimeErr *RuntimeError
+				if !errors.As(err, &runtimeErr) || runtimeErr.Kind != LimitError {
+					t.Fatalf("expected a LimitError, got %v", err)
+				}
+				if runtimeErr.Message != test.message {
+					t.Errorf("expected %q, got %q", test.message, runtimeErr.Message)
+				}
+				if len(runtimeErr.Trace) != 1 || runtimeErr.Trace[0].Program != "$spin" {
+					t.Errorf("expected a trace of the call to $spin, got %v", runtimeErr.Trace)
+				}
+			})
+		}
+	}
+}
+
+func TestContextIsOnlyCheckedEveryInterval(t *testing.T) {
+	source := `new :i 0
+while :i < 500
+    = :i :i + 1
+`
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, engine := range engines {
+		t.Run(engine.name, func(t *testing.T) {
+			options := engine.options
+			options.Context = cancelled
+			// fewer commands than checkInterval finish before the Context is looked at
+			if _, err := run(t, source, options); err != nil {
+				t.Errorf("expected the short program to finish, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package executor
+
+import (
+	"morklerork/symbols"
+	"sort"
+	"time"
+)
+
+// TopLevel is the name a Profile gives to the commands that run outside of any program
+const TopLevel = "(top level)"
+
+// Profile records where the time of a run goes: how many times each program
+// was called, how long it ran for, how many times each command ran and which
+// programs were running at once. Give the same Profile to many Interpreters,
+// such as one for each test, to add up all of their runs.
+// Timing every call slows a run down, the programs that make many small
+// calls are slowed the most
+type Profile struct {
+	programs map[string]*programProfile
+	hits     map[symbols.Position]int
+	// the chains of calls that were made, starting from each TopLevel
+	roots map[stackKey]*stackNode
+}
+
+// ProgramProfile is how many times a program was called and how long it ran.
+// Total includes the programs it called, Self does not. A call inside a
+// call of the same program, a recursive call, only counts towards Total once
+type ProgramProfile struct {
+	Name string
+	// Pos is where the program command creating it is, it is empty for HostPrograms and TopLevel
+	Pos   symbols.Position
+	Calls int
+	Total time.Duration
+	Self  time.Duration
+}
+
+type programProfile struct {
+	ProgramProfile
+	// active is how many calls of the program are running
+	active int
+}
+
+// ProfileFrame is one program in a StackSample, and where it was called from
+type ProfileFrame struct {
+	Program    string
+	ProgramPos symbols.Position
+	CallPos    symbols.Position
+}
+
+// StackSample is the time spent running the last of Frames, while the rest
+// of them were waiting for the program they called to return. Frames starts
+// with TopLevel. Calls is how many times that program was called from there
+type StackSample struct {
+	Frames []ProfileFrame
+	Calls  int
+	Self   time.Duration
+}
+
+// LineHits is how many times the command at Pos ran
+type LineHits struct {
+	Pos  symbols.Position
+	Hits int
+}
+
+// stackKey tells apart the calls made from one stackNode
+type stackKey struct {
+	program string
+	callPos symbols.Position
+}
+
+// stackNode is one program in a chain of calls, the calls it made are its children
+type stackNode struct {
+	frame    ProfileFrame
+	children map[stackKey]*stackNode
+	calls    int
+	self     time.Duration
+}
+
+// activation is a call that has not returned yet
+type activation struct {
+	program  *programProfile
+	node     *stackNode
+	start    time.Time
+	children time.Duration
+}
+
+// NewProfile creates a Profile with nothing recorded, to give to Options.Profile
+func NewProfile() *Profile {
+	return &Profile{
+		programs: make(map[string]*programProfile),
+		hits:     make(map[symbols.Position]int),
+		roots:    make(map[stackKey]*stackNode),
+	}
+}
+
+// hit counts a run of the command at pos, a nil Profile records nothing
+func (profile *Profile) hit(pos symbols.Position) {
+	if profile != nil {
+		profile.hits[pos]++
+	}
+}
+
+// enterProgram starts timing a call of program, which was created at
+// programPos, from callPos
+func (interpreter *Interpreter) enterProgram(program string, programPos symbols.Position, callPos symbols.Position) {
+	profile := interpreter.options.Profile
+	if profile == nil {
+		return
+	}
+	called, ok := profile.programs[program]
+	if !ok {
+		called = &programProfile{ProgramProfile: ProgramProfile{Name: program, Pos: programPos}}
+		profile.programs[program] = called
+	}
+	called.Calls++
+	called.active++
+
+	siblings := profile.roots
+	if len(interpreter.profileStack) > 0 {
+		siblings = interpreter.profileStack[len(interpreter.profileStack)-1].node.children
+	}
+	key := stackKey{program: program, callPos: callPos}
+	node, ok := siblings[key]
+	if !ok {
+		node = &stackNode{
+			frame:    ProfileFrame{Program: program, ProgramPos: programPos, CallPos: callPos},
+			children: make(map[stackKey]*stackNode),
+		}
+		siblings[key] = node
+	}
+	node.calls++
+
+	interpreter.profileStack = append(interpreter.profileStack, activation{program: called, node: node, start: time.Now()})
+}
+
+// exitProgram stops timing the innermost call, adding its time to the Profile
+func (interpreter *Interpreter) exitProgram() {
+	if interpreter.options.Profile == nil || len(interpreter.profileStack) == 0 {
+		return
+	}
+	returning := interpreter.profileStack[len(interpreter.profileStack)-1]
+	interpreter.profileStack = interpreter.profileStack[:len(interpreter.profileStack)-1]
+
+	elapsed := time.Since(returning.start)
+	self := elapsed - returning.children
+	returning.program.Self += self
+	returning.program.active--
+	if returning.program.active == 0 {
+		returning.program.Total += elapsed
+	}
+	returning.node.self += self
+	if len(interpreter.profileStack) > 0 {
+		interpreter.profileStack[len(interpreter.profileStack)-1].children += elapsed
+	}
+}
+
+// unwindProfile stops timing every call past the first depth, for calls
+// that an error stopped before they could return
+func (interpreter *Interpreter) unwindProfile(depth int) {
+	for len(interpreter.profileStack) > depth {
+		interpreter.exitProgram()
+	}
+}
+
+// Programs lists every program that was called, and TopLevel, with the one
+// that ran for longest in total first
+func (profile *Profile) Programs() []ProgramProfile {
+	programs := make([]ProgramProfile, 0, len(profile.programs))
+	for _, program := range profile.programs {
+		programs = append(programs, program.ProgramProfile)
+	}
+	sort.Slice(programs, func(i, j int) bool {
+		if programs[i].Total != programs[j].Total {
+			return programs[i].Total > programs[j].Total
+		}
+		return programs[i].Name < programs[j].Name
+	})
+	return programs
+}
+
+// Stacks lists every chain of calls that was made, each after the chain
+// that made its last call
+func (profile *Profile) Stacks() []StackSample {
+	stacks := make([]StackSample, 0)
+	var visit func(nodes map[stackKey]*stackNode, callers []ProfileFrame)
+	visit = func(nodes map[stackKey]*stackNode, callers []ProfileFrame) {
+		for _, node := range sortedNodes(nodes) {
+			frames := append(append(make([]ProfileFrame, 0, len(callers)+1), callers...), node.frame)
+			stacks = append(stacks, StackSample{Frames: frames, Calls: node.calls, Self: node.self})
+			visit(node.children, frames)
+		}
+	}
+	visit(profile.roots, nil)
+	return stacks
+}
+
+// sortedNodes orders the calls made from one place by program name, then where they were called
+func sortedNodes(nodes map[stackKey]*stackNode) []*stackNode {
+	sorted := make([]*stackNode, 0, len(nodes))
+	for _, node := range nodes {
+		sorted = append(sorted, node)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].frame.Program != sorted[j].frame.Program {
+			return sorted[i].frame.Program < sorted[j].frame.Program
+		}
+		return positionLess(sorted[i].frame.CallPos, sorted[j].frame.CallPos)
+	})
+	return sorted
+}
+
+// Lines lists how many times each command that ran was run, the most first
+func (profile *Profile) Lines() []LineHits {
+	lines := make([]LineHits, 0, len(profile.hits))
+	for pos, hits := range profile.hits {
+		lines = append(lines, LineHits{Pos: pos, Hits: hits})
+	}
+	sort.Slice(lines, func(i, j int) bool {
+		if lines[i].Hits != lines[j].Hits {
+			return lines[i].Hits > lines[j].Hits
+		}
+		return positionLess(lines[i].Pos, lines[j].Pos)
+	})
+	return lines
+}
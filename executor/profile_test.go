@@ -0,0 +1,140 @@
+package executor
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+// callTree calls $inner from the top level, and twice from $outer
+const callTree = `program $inner :n
+    new :i 0
+    while :i < :n
+        = :i :i + 1
+
+program $outer
+    call $inner 50
+    call $inner 50
+
+call $outer
+call $inner 10
+`
+
+func TestProfileCallTree(t *testing.T) {
+	for _, engine := range engines {
+		t.Run(engine.name, func(t *testing.T) {
+			options := engine.options
+			options.Profile = NewProfile()
+			if _, err := run(t, callTree, options); err != nil {
+				t.Fatal(err)
+			}
+
+			programs := make(map[string]ProgramProfile)
+			for _, program := range options.Profile.Programs() {
+				programs[program.Name] = program
+			}
+			calls := map[string]int{TopLevel: 1, "$outer": 1, "$inner": 3}
+			if len(programs) != len(calls) {
+				t.Fatalf("expected %d programs, got %v", len(calls), programs)
+			}
+			for name, expected := range calls {
+				if programs[name].Calls != expected {
+					t.Errorf("expected %s to be called %d times, got %d", name, expected, programs[name].Calls)
+				}
+			}
+			if programs["$inner"].Pos.Line != 1 || programs["$outer"].Pos.Line != 6 {
+				t.Errorf("expected the programs to be created on lines 1 and 6, got %v", programs)
+			}
+
+			stacks := make(map[string]StackSample)
+			var allSelf time.Duration
+			for _, stack := range options.Profile.Stacks() {
+				names := make([]string, 0, len(stack.Frames))
+				for _, frame := range stack.Frames {
+					names = append(names, frame.Program)
+				}
+				stacks[strings.Join(names, ";")+" "+stack.Frames[len(stack.Frames)-1].CallPos.String()] = stack
+				allSelf += stack.Self
+			}
+			stackCalls := map[string]int{
+				TopLevel + " ":                          1,
+				TopLevel + ";$outer test.mr:10:1":       1,
+				TopLevel + ";$outer;$inner test.mr:7:5": 1,
+				TopLevel + ";$outer;$inner test.mr:8:5": 1,
+				TopLevel + ";$inner test.mr:11:1":       1,
+			}
+			if len(stacks) != len(stackCalls) {
+				t.Fatalf("expected %d stacks, got %v", len(stackCalls), stacks)
+			}
+			for key, expected := range stackCalls {
+				if stacks[key].Calls != expected {
+					t.Errorf("expected %q to be called %d times, got %d", key, expected, stacks[key].Calls)
+				}
+			}
+
+			// the time of a call is its self time and the time of the calls it made
+			outer := programs["$outer"]
+			fromOuter := stacks[TopLevel+";$outer;$inner test.mr:7:5"].Self + stacks[TopLevel+";$outer;$inner test.mr:8:5"].Self
+			if outer.Total != outer.Self+fromOuter {
+				t.Errorf("expected the total of $outer, %s, to be its self %s and the %s of $inner it called", outer.Total, outer.Self, fromOuter)
+			}
+			if programs["$inner"].Total != programs["$inner"].Self {
+				t.Errorf("expected $inner, which calls nothing, to have the same total and self, got %v", programs["$inner"])
+			}
+			if programs[TopLevel].Total != allSelf {
+				t.Errorf("expected the top level total %s to be the self time of every stack, %s", programs[TopLevel].Total, allSelf)
+			}
+
+			hits := make(map[int]int)
+			for _, line := range options.Profile.Lines() {
+				hits[line.Pos.Line] += line.Hits
+			}
+			if hits[4] != 110 || hits[7] != 1 || hits[10] != 1 {
+				t.Errorf("expected line 4 to run 110 times and lines 7 and 10 once, got %v", hits)
+			}
+		})
+	}
+}
+
+func TestProfileUnwindsAfterAnError(t *testing.T) {
+	source := `program $fail :n
+    if :n == 0
+        log 1 / :n
+    call $fail (:n - 1)
+
+call $fail 3
+`
+	for _, engine := range engines {
+		t.Run(engine.name, func(t *testing.T) {
+			options := engine.options
+			options.Profile = NewProfile()
+			var output bytes.Buffer
+			interpreter := NewInterpreter(strings.NewReader(""), &output, DefaultHeapSize, options)
+			if err := interpreter.Execute(parse(t, source)); err == nil {
+				t.Fatal("expected dividing by zero to stop the program")
+			}
+			if len(interpreter.profileStack) != 0 {
+				t.Fatalf("expected every call to be unwound, %d are left", len(interpreter.profileStack))
+			}
+
+			// a later run is timed from the top level again, not inside the calls that failed
+			if err := interpreter.Execute(parse(t, "program $ok\n    log 'ok'\ncall $ok\n")); err != nil {
+				t.Fatal(err)
+			}
+			if len(interpreter.profileStack) != 0 {
+				t.Errorf("expected the stack to be empty after a run, %d are left", len(interpreter.profileStack))
+			}
+			for _, stack := range options.Profile.Stacks() {
+				if stack.Frames[len(stack.Frames)-1].Program == "$ok" && len(stack.Frames) != 2 {
+					t.Errorf("expected $ok to be called from the top level, got %v", stack.Frames)
+				}
+			}
+			for _, program := range options.Profile.Programs() {
+				if program.Name == "$fail" && (program.Calls != 4 || program.Total <= 0) {
+					t.Errorf("expected $fail to be called 4 times and be timed, got %v", program)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package executor
+
+import (
+	"morklerork/ast"
+	"morklerork/symbols"
+	"sort"
+)
+
+// CallFrame is one program that is running, where it was called from, and the
+// arguments it was called with
+type CallFrame struct {
+	Program   string
+	Pos       symbols.Position
+	Arguments []ExpressionResult
+	// the scope of the command that called the program, so a debugger can look
+	// at the variables of every frame, not just the running one
+	callerScope scope
+}
+
+// String writes the frame the way the program was called, followed by where it was called from
+func (frame CallFrame) String() string {
+	call := frame.Program
+	for _, argument := range frame.Arguments {
+		call += " " + argument.Literal()
+	}
+	return call + ", called at " + frame.Pos.String()
+}
+
+// trace copies the tree walker's call stack for a RuntimeError, without the
+// scopes, which the error has no use for
+func (interpreter *Interpreter) trace() []CallFrame {
+	trace := make([]CallFrame, 0, len(interpreter.callStack))
+	for _, frame := range interpreter.callStack {
+		trace = append(trace, CallFrame{Program: frame.Program, Pos: frame.Pos, Arguments: frame.Arguments})
+	}
+	return trace
+}
+
+// traceError gives a RuntimeError the tree walker's call stack, if it does not
+// have a trace yet. The innermost call adds it, so the calls the error returns
+// through do not copy the stack again
+func (interpreter *Interpreter) traceError(err error) error {
+	if runtimeErr, ok := err.(*RuntimeError); !ok || len(runtimeErr.Trace) > 0 {
+		return err
+	}
+	return withTrace(err, interpreter.trace())
+}
+
+// Step is given to Options.Hook before each command runs
+type Step struct {
+	Command     ast.Command
+	scope       scope
+	interpreter *Interpreter
+}
+
+// Depth is the number of programs being run
+func (step Step) Depth() int {
+	return len(step.interpreter.callStack)
+}
+
+// CallStack lists the programs being run, outermost first,
+// it is empty when the command is at the top level
+func (step Step) CallStack() []CallFrame {
+	return append([]CallFrame{}, step.interpreter.callStack...)
+}
+
+// scopeOf finds the scope of a frame, counting out from 0 for the running
+// program, up to Depth for the top level
+func (step Step) scopeOf(frame int) scope {
+	if frame == 0 {
+		return step.scope
+	}
+	return step.interpreter.callStack[len(step.interpreter.callStack)-frame].callerScope
+}
+
+// Scopes lists the variables in each block scope of a frame, outermost first,
+// see scopeOf for how frames are counted. Each scope is sorted by name
+func (step Step) Scopes(frame int) [][]Variable {
+	frameScope := step.scopeOf(frame)
+	scopes := make([][]Variable, 0, len(frameScope))
+	for _, block := range frameScope {
+		variables := make([]Variable, 0, len(block))
+		for name, value := range block {
+			variables = append(variables, Variable{Name: name, Value: value})
+		}
+		sort.Slice(variables, func(i, j int) bool {
+			return variables[i].Name < variables[j].Name
+		})
+		scopes = append(scopes, variables)
+	}
+	return scopes
+}
+
+// Evaluate works out the value of an expression in the scope of a frame,
+// see scopeOf for how frames are counted
+func (step Step) Evaluate(frame int, expression ast.Expression) (ExpressionResult, error) {
+	return step.interpreter.evaluateExpression(expression, step.scopeOf(frame))
+}
@@ -0,0 +1,322 @@
+package executor
+
+import (
+	"fmt"
+	"morklerork/symbols"
+)
+
+type globalVariable struct {
+	value   ExpressionResult
+	defined bool
+}
+
+// frame is one running chunk, either the top level or a called program
+type frame struct {
+	chunk *chunk
+	pc    int
+	slots []ExpressionResult
+	// where the caller wants the return value, see opCall
+	returnTargetKind  int
+	returnTargetIndex int
+	returnTargetPos   symbols.Position
+	// the name of the program the frame is running, "" at the top level
+	program string
+	// where the program was called, and the arguments it was called with, for a RuntimeError's Trace
+	callPos   symbols.Position
+	arguments []ExpressionResult
+}
+
+// trace lists the programs the frames are running for a RuntimeError's Trace
+func trace(frames []frame) []CallFrame {
+	trace := make([]CallFrame, 0, len(frames))
+	for _, frame := range frames {
+		if frame.program != "" {
+			trace = append(trace, CallFrame{Program: frame.program, Pos: frame.callPos, Arguments: frame.arguments})
+		}
+	}
+	return trace
+}
+
+func (interpreter *Interpreter) undefinedVariableError(pos symbols.Position, name string) error {
+	return newRuntimeError(pos, UndefinedVariableError, "Could not find variable "+name+" in scope. Did you declare it first?")
+}
+
+func (interpreter *Interpreter) redefinedVariableError(pos symbols.Position, name string) error {
+	return newRuntimeError(pos, RedefinedVariableError, "VariableName "+name+" is already defined in this scope")
+}
+
+// global makes sure the Interpreter has room for global index, since the
+// globalTable can grow between runs
+func (interpreter *Interpreter) global(index int) *globalVariable {
+	for len(interpreter.globals) <= index {
+		interpreter.globals = append(interpreter.globals, globalVariable{})
+	}
+	return &interpreter.globals[index]
+}
+
+// heapAddress checks a value popped off the stack can be used as a heap address
+func heapAddress(address ExpressionResult, pos symbols.Position) (int, error) {
+	if address.Type != Int {
+		return 0, newRuntimeError(pos, TypeError, "tried to access the heap with value that is not an int")
+	}
+	return address.Int, nil
+}
+
+// storeReturnValue puts the value a call returned in its return target, see opCall
+func (interpreter *Interpreter) storeReturnValue(caller *frame, targetKind int, targetIndex int, pos symbols.Position, val ExpressionResult) error {
+	switch targetKind {
+	case localReturnTarget:
+		caller.slots[targetIndex] = val
+	case globalReturnTarget:
+		global := interpreter.global(targetIndex)
+		if !global.defined {
+			return interpreter.undefinedVariableError(pos, interpreter.globalNames.names[targetIndex])
+		}
+		global.value = val
+	case undefinedReturnTarget:
+		return interpreter.undefinedVariableError(pos, caller.chunk.names[targetIndex])
+	}
+	return nil
+}
+
+// runChunk executes top level code on the bytecode engine, returning the value
+// of a top level return, if it had one
+func (interpreter *Interpreter) runChunk(topLevel *chunk) (ExpressionResult, error) {
+	val, _, err := interpreter.runFrame(frame{chunk: topLevel, slots: make([]ExpressionResult, topLevel.slotCount)})
+	return val, err
+}
+
+// runFrame executes a chunk until it returns, and reports whether it returned a value.
+// Calls push frames onto an explicit stack rather than recursing in go
+func (interpreter *Interpreter) runFrame(first frame) (result ExpressionResult, hasValue bool, err error) {
+	stack := make([]ExpressionResult, 0, 64)
+	frames := []frame{first}
+	profileDepth := len(interpreter.profileStack)
+	defer func() {
+		if err != nil {
+			err = withTrace(err, trace(frames))
+		}
+		interpreter.unwindProfile(profileDepth)
+	}()
+	// how many programs are running is the number of frames, less one for the top level
+	topLevelFrames := 0
+	if first.program == "" {
+		topLevelFrames = 1
+	}
+
+	pop := func() ExpressionResult {
+		val := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		return val
+	}
+
+	// the program looked up by the last opPrepareCall, arguments can not contain calls
+	// so there is only ever one call being prepared. Only one of them is set
+	var preparedProgram *compiledProgram
+	var preparedHost *hostProgram
+	// where the call was prepared, as opCall has the position of the return target
+	var preparedPos symbols.Position
+
+	for {
+		current := &frames[len(frames)-1]
+
+		if current.pc >= len(current.chunk.code) {
+			// falling off the end is the same as a return with no value
+			if len(frames) == 1 {
+				return ExpressionResult{}, false, nil
+			}
+			frames = frames[:len(frames)-1]
+			interpreter.exitProgram()
+			continue
+		}
+
+		ins := current.chunk.code[current.pc]
+		pos := current.chunk.positions[current.pc]
+		current.pc++
+
+		switch ins.op {
+		case opConstant:
+			stack = append(stack, current.chunk.constants[ins.a])
+		case opLoad:
+			stack = append(stack, current.slots[ins.a])
+		case opStore:
+			current.slots[ins.a] = pop()
+		case opLoadGlobal:
+			global := interpreter.global(ins.a)
+			if !global.defined {
+				return ExpressionResult{}, false, interpreter.undefinedVariableError(pos, interpreter.globalNames.names[ins.a])
+			}
+			stack = append(stack, global.value)
+		case opStoreGlobal:
+			global := interpreter.global(ins.a)
+			if !global.defined {
+				return ExpressionResult{}, false, interpreter.undefinedVariableError(pos, interpreter.globalNames.names[ins.a])
+			}
+			global.value = pop()
+		case opDefineGlobal:
+			global := interpreter.global(ins.a)
+			if global.defined {
+				return ExpressionResult{}, false, interpreter.redefinedVariableError(pos, interpreter.globalNames.names[ins.a])
+			}
+			global.value = pop()
+			global.defined = true
+		case opCheckGlobalUndefined:
+			if interpreter.global(ins.a).defined {
+				return ExpressionResult{}, false, interpreter.redefinedVariableError(pos, interpreter.globalNames.names[ins.a])
+			}
+		case opUndefinedVariable:
+			return ExpressionResult{}, false, interpreter.undefinedVariableError(pos, current.chunk.names[ins.a])
+		case opRedefinedVariable:
+			return ExpressionResult{}, false, interpreter.redefinedVariableError(pos, current.chunk.names[ins.a])
+		case opLoadHeap:
+			address, err := heapAddress(pop(), pos)
+			if err != nil {
+				return ExpressionResult{}, false, err
+			}
+			val, err := interpreter.heap.read(address, pos)
+			if err != nil {
+				return ExpressionResult{}, false, err
+			}
+			stack = append(stack, val)
+		case opStoreHeap:
+			address, err := heapAddress(pop(), pos)
+			if err != nil {
+				return ExpressionResult{}, false, err
+			}
+			if err := interpreter.heap.write(address, pop(), pos); err != nil {
+				return ExpressionResult{}, false, err
+			}
+		case opBinaryOperator:
+			rhs := pop()
+			lhs := pop()
+			result, err := applyBinaryOperator(lhs, rhs, symbols.BinaryOperatorType(ins.a), pos)
+			if err != nil {
+				return ExpressionResult{}, false, err
+			}
+			stack = append(stack, result)
+		case opLog:
+			interpreter.print(pop())
+		case opRead:
+			rawRune, err := interpreter.readRune()
+			if err != nil {
+				return ExpressionResult{}, false, newRuntimeError(pos, InputError, err.Error())
+			}
+			stack = append(stack, ExpressionResult{Type: String, String: string(rawRune)})
+		case opJump:
+			current.pc = ins.a
+		case opJumpIfFalse:
+			cond := pop()
+			if cond.Type != Bool {
+				return ExpressionResult{}, false, newRuntimeError(pos, TypeError, conditionNames[ins.b]+" condition did not evaluate to a boolean")
+			}
+			interpreter.options.Coverage.branch(pos, cond.Bool)
+			if !cond.Bool {
+				current.pc = ins.a
+			}
+		case opDefineProgram:
+			program := current.chunk.programs[ins.a]
+			if err := interpreter.checkNotHostProgram(program.name, pos); err != nil {
+				return ExpressionResult{}, false, err
+			}
+			interpreter.compiledPrograms[program.name] = program
+		case opPrepareCall:
+			name := current.chunk.names[ins.a]
+			preparedProgram, preparedHost = nil, nil
+			program, ok := interpreter.compiledPrograms[name]
+			if host, isHost := interpreter.hostPrograms[name]; !ok && isHost {
+				if ins.b != len(host.parameterNames) {
+					return ExpressionResult{}, false, newRuntimeError(pos, ArgumentCountError, "Tried to call "+name+" with "+fmt.Sprint(ins.b)+" But it expects "+fmt.Sprint(len(host.parameterNames))+" parameters")
+				}
+				preparedHost, preparedPos = host, pos
+				continue
+			}
+			if !ok {
+				return ExpressionResult{}, false, newRuntimeError(pos, UndefinedProgramError, "Tried to call "+name+" but it has not been created")
+			}
+			if ins.b != program.parameters {
+				return ExpressionResult{}, false, newRuntimeError(pos, ArgumentCountError, "Tried to call "+name+" with "+fmt.Sprint(ins.b)+" But it expects "+fmt.Sprint(program.parameters)+" parameters")
+			}
+			preparedProgram, preparedPos = program, pos
+		case opArgument:
+			if preparedProgram == nil {
+				continue
+			}
+			if err := preparedProgram.parameterErrors[ins.a]; err != nil {
+				return ExpressionResult{}, false, err
+			}
+		case opCall:
+			if preparedHost != nil {
+				args := append([]Value{}, stack[len(stack)-len(preparedHost.parameterNames):]...)
+				stack = stack[:len(stack)-len(preparedHost.parameterNames)]
+				val, err := interpreter.runHostProgram(preparedHost, args, preparedPos)
+				if err != nil {
+					return ExpressionResult{}, false, err
+				}
+				if err := interpreter.storeReturnValue(current, ins.a, ins.b, pos, val); err != nil {
+					return ExpressionResult{}, false, err
+				}
+				continue
+			}
+			program := preparedProgram
+			if err := interpreter.checkCallDepth(len(frames)-topLevelFrames, preparedPos, current.program); err != nil {
+				return ExpressionResult{}, false, err
+			}
+			// the arguments are kept after the slots, the slots of parameters can be assigned to
+			storage := make([]ExpressionResult, program.chunk.slotCount+program.parameters)
+			slots, arguments := storage[:program.chunk.slotCount:program.chunk.slotCount], storage[program.chunk.slotCount:]
+			copy(slots, stack[len(stack)-program.parameters:])
+			copy(arguments, stack[len(stack)-program.parameters:])
+			stack = stack[:len(stack)-program.parameters]
+			frames = append(frames, frame{
+				chunk:             program.chunk,
+				slots:             slots,
+				returnTargetKind:  ins.a,
+				returnTargetIndex: ins.b,
+				returnTargetPos:   pos,
+				program:           program.name,
+				callPos:           preparedPos,
+				arguments:         arguments,
+			})
+			interpreter.enterProgram(program.name, program.pos, preparedPos)
+		case opReturn:
+			if len(frames) == 1 {
+				// a return from the first frame ends the run
+				if ins.a == 0 {
+					return ExpressionResult{}, false, nil
+				}
+				return pop(), true, nil
+			}
+			returning := frames[len(frames)-1]
+			frames = frames[:len(frames)-1]
+			interpreter.exitProgram()
+			if ins.a == 0 {
+				continue
+			}
+			if err := interpreter.storeReturnValue(&frames[len(frames)-1], returning.returnTargetKind, returning.returnTargetIndex, returning.returnTargetPos, pop()); err != nil {
+				return ExpressionResult{}, false, err
+			}
+		case opAssert:
+			cond := pop()
+			if cond.Type != Bool {
+				return ExpressionResult{}, false, newRuntimeError(pos, TypeError, conditionNames[ins.b]+" condition did not evaluate to a boolean")
+			}
+			if cond.Bool {
+				current.pc = ins.a
+			}
+		case opAssertFailed:
+			if ins.a == 0 {
+				return ExpressionResult{}, false, assertionFailed(pos, ExpressionResult{}, false)
+			}
+			return ExpressionResult{}, false, assertionFailed(pos, pop(), true)
+		case opStep:
+			if err := interpreter.step(pos, current.program); err != nil {
+				return ExpressionResult{}, false, err
+			}
+		case opCountCommand:
+			interpreter.options.Coverage.ran(pos)
+			interpreter.options.Profile.hit(pos)
+		case opStrayControlFlow:
+			return ExpressionResult{}, false, strayControlSignalError(controlSignal{kind: signalKind(ins.a), pos: pos})
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package format
+
+import (
+	"fmt"
+	"strings"
+)
+
+// contextLines is how many unchanged lines are shown around each change in a diff
+const contextLines = 3
+
+// edit is one line of a diff, kind is ' ' for a line in both, '-' for a line
+// only in the old text and '+' for a line only in the new text
+type edit struct {
+	kind rune
+	text string
+}
+
+// Diff writes a unified diff from the old text of a file to the new text,
+// or "" if they are the same
+func Diff(fileName string, oldText string, newText string) string {
+	return LabeledDiff(fileName, fileName+" (formatted)", oldText, newText)
+}
+
+// LabeledDiff writes a unified diff from oldText to newText, naming them
+// oldLabel and newLabel in its header, or "" if they are the same
+func LabeledDiff(oldLabel string, newLabel string, oldText string, newText string) string {
+	if oldText == newText {
+		return ""
+	}
+	edits := lineEdits(strings.Split(oldText, "\n"), strings.Split(newText, "\n"))
+
+	var diff strings.Builder
+	fmt.Fprintf(&diff, "--- %s\n+++ %s\n", oldLabel, newLabel)
+	for start := 0; start < len(edits); {
+		if edits[start].kind == ' ' {
+			start++
+			continue
+		}
+		// a hunk runs until there are more than twice the context lines without a change
+		end := start
+		for unchanged := 0; end < len(edits) && unchanged <= 2*contextLines; end++ {
+			if edits[end].kind == ' ' {
+				unchanged++
+			} else {
+				unchanged = 0
+			}
+		}
+		hunkStart := start - contextLines
+		if hunkStart < 0 {
+			hunkStart = 0
+		}
+		hunkEnd := end
+		for hunkEnd > start && edits[hunkEnd-1].kind == ' ' {
+			hunkEnd--
+		}
+		hunkEnd += contextLines
+		if hunkEnd > len(edits) {
+			hunkEnd = len(edits)
+		}
+		writeHunk(&diff, edits, hunkStart, hunkEnd)
+		start = hunkEnd
+	}
+	return diff.String()
+}
+
+func writeHunk(diff *strings.Builder, edits []edit, start int, end int) {
+	oldLine, newLine := 1, 1
+	for _, edit := range edits[:start] {
+		if edit.kind != '+' {
+			oldLine++
+		}
+		if edit.kind != '-' {
+			newLine++
+		}
+	}
+	oldCount, newCount := 0, 0
+	for _, edit := range edits[start:end] {
+		if edit.kind != '+' {
+			oldCount++
+		}
+		if edit.kind != '-' {
+			newCount++
+		}
+	}
+
+	fmt.Fprintf(diff, "@@ -%d,%d +%d,%d @@\n", oldLine, oldCount, newLine, newCount)
+	for _, edit := range edits[start:end] {
+		diff.WriteString(string(edit.kind) + edit.text + "\n")
+	}
+}
+
+// lineEdits finds the fewest lines to remove and add to turn oldLines into
+// newLines, from the longest common subsequence of the two
+func lineEdits(oldLines []string, newLines []string) []edit {
+	// common[i][j] is the length of the longest common subsequence of oldLines[i:] and newLines[j:]
+	common := make([][]int, len(oldLines)+1)
+	for i := range common {
+		common[i] = make([]int, len(newLines)+1)
+	}
+	for i := len(oldLines) - 1; i >= 0; i-- {
+		for j := len(newLines) - 1; j >= 0; j-- {
+			if oldLines[i] == newLines[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else if common[i+1][j] >= common[i][j+1] {
+				common[i][j] = common[i+1][j]
+			} else {
+				common[i][j] = common[i][j+1]
+			}
+		}
+	}
+
+	edits := make([]edit, 0, len(oldLines)+len(newLines))
+	i, j := 0, 0
+	for i < len(oldLines) && j < len(newLines) {
+		if oldLines[i] == newLines[j] {
+			edits = append(edits, edit{kind: ' ', text: oldLines[i]})
+			i++
+			j++
+		} else if common[i+1][j] >= common[i][j+1] {
+			edits = append(edits, edit{kind: '-', text: oldLines[i]})
+			i++
+		} else {
+			edits = append(edits, edit{kind: '+', text: newLines[j]})
+			j++
+		}
+	}
+	for ; i < len(oldLines); i++ {
+		edits = append(edits, edit{kind: '-', text: oldLines[i]})
+	}
+	for ; j < len(newLines); j++ {
+		edits = append(edits, edit{kind: '+', text: newLines[j]})
+	}
+	return edits
+}
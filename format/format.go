@@ -0,0 +1,204 @@
+package format
+
+import (
+	"morklerork/ast"
+	"morklerork/lexer"
+	"morklerork/parser"
+	"morklerork/symbols"
+	"strconv"
+	"strings"
+)
+
+// indentWidth is how many spaces each block is indented by
+const indentWidth = 4
+
+// comment is a comment line from the source, which the ast does not keep
+type comment struct {
+	line int
+	text string
+}
+
+type formatter struct {
+	output []string
+	// comments not yet written, in the order they appear
+	comments []comment
+	// blank lines in the source, by line number
+	blankLines map[int]bool
+	// the source line of the last line written
+	lastLine int
+	// set after a command with a block, so the block does not start with a blank line
+	isAfterHeader bool
+}
+
+// Source formats a MorkleRork file, fileName is only used in errors.
+// Commands are written with one space between symbols and indented by four
+// spaces per block. String and int literals are written the same way
+// however they were escaped, and parentheses are only kept where they
+// change the meaning of an expression. Comments are kept, indented like
+// the command after them, and any run of blank lines becomes one
+func Source(fileName string, text string) (string, error) {
+	fileSymbols, err := lexer.Lex(fileName, text)
+	if err != nil {
+		return "", err
+	}
+	commands, _, err := parser.ParseBlock(fileSymbols, 0)
+	if err != nil {
+		return "", err
+	}
+
+	formatter := &formatter{blankLines: make(map[int]bool)}
+	for i, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			formatter.blankLines[i+1] = true
+		} else if strings.HasPrefix(trimmed, "#") {
+			formatter.comments = append(formatter.comments, comment{line: i + 1, text: trimmed})
+		}
+	}
+
+	formatter.writeBlock(commands, 0)
+	for _, comment := range formatter.comments {
+		formatter.write(comment.line, 0, comment.text)
+	}
+	if len(formatter.output) == 0 {
+		return "", nil
+	}
+	return strings.Join(formatter.output, "\n") + "\n", nil
+}
+
+// write adds one line, after a blank line if there was one before it in the source
+func (formatter *formatter) write(sourceLine int, depth int, text string) {
+	if len(formatter.output) > 0 && !formatter.isAfterHeader {
+		for line := formatter.lastLine + 1; line < sourceLine; line++ {
+			if formatter.blankLines[line] {
+				formatter.output = append(formatter.output, "")
+				break
+			}
+		}
+	}
+	formatter.output = append(formatter.output, strings.Repeat(" ", depth*indentWidth)+text)
+	formatter.lastLine = sourceLine
+	formatter.isAfterHeader = false
+}
+
+// writeCommandLine writes the comments before a command, then the command
+func (formatter *formatter) writeCommandLine(pos symbols.Position, depth int, text string) {
+	for len(formatter.comments) > 0 && formatter.comments[0].line < pos.Line {
+		formatter.write(formatter.comments[0].line, depth, formatter.comments[0].text)
+		formatter.comments = formatter.comments[1:]
+	}
+	formatter.write(pos.Line, depth, text)
+}
+
+// writeHeader writes a command that has a block, then the block
+func (formatter *formatter) writeHeader(pos symbols.Position, depth int, text string, commands []ast.Command) {
+	formatter.writeCommandLine(pos, depth, text)
+	formatter.isAfterHeader = true
+	formatter.writeBlock(commands, depth+1)
+}
+
+func (formatter *formatter) writeBlock(commands []ast.Command, depth int) {
+	for _, command := range commands {
+		formatter.writeCommand(command, depth)
+	}
+}
+
+func (formatter *formatter) writeCommand(command ast.Command, depth int) {
+	pos := ast.PositionOf(command)
+	switch command := command.(type) {
+	case ast.Log:
+		formatter.writeCommandLine(pos, depth, "log "+expression(command.Expr))
+	case ast.Read:
+		formatter.writeCommandLine(pos, depth, "read "+expression(command.Target))
+	case ast.New:
+		formatter.writeCommandLine(pos, depth, "new "+command.VariableName+" "+expression(command.Expr))
+	case ast.Assign:
+		formatter.writeCommandLine(pos, depth, "= "+expression(command.Target)+" "+expression(command.Expr))
+	case ast.If:
+		formatter.writeHeader(pos, depth, "if "+expression(command.Cond), command.Commands)
+		for _, elseIf := range command.ElseIfs {
+			formatter.writeHeader(elseIf.Pos, depth, "elif "+expression(elseIf.Cond), elseIf.Commands)
+		}
+		if command.HasElse {
+			formatter.writeHeader(command.Else.Pos, depth, "else", command.Else.Commands)
+		}
+	case ast.While:
+		formatter.writeHeader(pos, depth, "while "+expression(command.Cond), command.Commands)
+	case ast.Program:
+		text := "program " + command.Name.Name
+		for _, parameter := range command.Parameters {
+			text += " " + parameter.Name
+		}
+		formatter.writeHeader(pos, depth, text, command.Commands)
+	case ast.Call:
+		text := "call "
+		if command.HasReturnTarget {
+			text += command.ReturnTarget.Name + " "
+		}
+		text += command.Name.Name
+		for _, argument := range command.Expressions {
+			text += " " + operand(argument)
+		}
+		formatter.writeCommandLine(pos, depth, text)
+	case ast.Return:
+		text := "return"
+		if command.HasExpression {
+			text += " " + expression(command.Expression)
+		}
+		formatter.writeCommandLine(pos, depth, text)
+	case ast.Break:
+		formatter.writeCommandLine(pos, depth, "break")
+	case ast.Continue:
+		formatter.writeCommandLine(pos, depth, "continue")
+	case ast.Import:
+		formatter.writeCommandLine(pos, depth, "import "+lexer.Quote(command.Path))
+	case ast.Assert:
+		text := "assert " + expression(command.Cond)
+		if command.HasMessage {
+			text += " " + operand(command.Message)
+		}
+		formatter.writeCommandLine(pos, depth, text)
+	}
+}
+
+// expression writes an expression with the fewest parentheses that parse back to the same ast
+func expression(node ast.Expression) string {
+	switch node := node.(type) {
+	case ast.StringLiteral:
+		return lexer.Quote(node.Value)
+	case ast.IntLiteral:
+		return strconv.Itoa(node.Value)
+	case ast.BooleanLiteral:
+		if node.Value {
+			return "?true"
+		}
+		return "?false"
+	case ast.VariableName:
+		return node.Name
+	case ast.ProgramName:
+		return node.Name
+	case ast.HeapAccess:
+		return "[" + expression(node.IndexExpression) + "]"
+	case ast.BinaryOperator:
+		precedence := symbols.BinaryOperatorPrecedence[node.BinaryOperatorType]
+		lhs, rhs := expression(node.Lhs), expression(node.Rhs)
+		// operators are left associative, so a right hand side of the
+		// same precedence was in parentheses
+		if lhsOperator, ok := node.Lhs.(ast.BinaryOperator); ok && symbols.BinaryOperatorPrecedence[lhsOperator.BinaryOperatorType] < precedence {
+			lhs = "(" + lhs + ")"
+		}
+		if rhsOperator, ok := node.Rhs.(ast.BinaryOperator); ok && symbols.BinaryOperatorPrecedence[rhsOperator.BinaryOperatorType] <= precedence {
+			rhs = "(" + rhs + ")"
+		}
+		return lhs + " " + symbols.BinaryOperatorTypeNames[node.BinaryOperatorType] + " " + rhs
+	}
+	return ""
+}
+
+// operand writes a call argument or assert message, which needs parentheses around any operators
+func operand(node ast.Expression) string {
+	if _, ok := node.(ast.BinaryOperator); ok {
+		return "(" + expression(node) + ")"
+	}
+	return expression(node)
+}
@@ -0,0 +1,108 @@
+package format
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		expected string
+	}{
+		{
+			name:     "spacing and indentation",
+			source:   "new :x (1)\nif ( :x == 1 )\n  log 'one'\n  if ?true\n   log 'two'\n",
+			expected: "new :x 1\nif :x == 1\n    log 'one'\n    if ?true\n        log 'two'\n",
+		},
+		{
+			name:     "literals",
+			source:   "log '\\x41'\nlog +7\n",
+			expected: "log 'A'\nlog 7\n",
+		},
+		{
+			name:     "parentheses",
+			source:   "log ((1 + 2)) * (3)\ncall $f ((1 + 2)) (3)\n",
+			expected: "log (1 + 2) * 3\ncall $f (1 + 2) 3\n",
+		},
+		{
+			name:     "blank lines",
+			source:   "\n\nlog 1\n\n\n\nlog 2\n\n",
+			expected: "log 1\n\nlog 2\n",
+		},
+		{
+			name:     "comments are indented like the command after them",
+			source:   "# about $f\nprogram $f :a\n# the first line\n  log :a\n      # the last line\n  return :a\n",
+			expected: "# about $f\nprogram $f :a\n    # the first line\n    log :a\n    # the last line\n    return :a\n",
+		},
+		{
+			name:     "comments at the end of the file",
+			source:   "log 1\n\n   # the end\n#   really\n",
+			expected: "log 1\n\n# the end\n#   really\n",
+		},
+		{
+			name:     "a file of only comments",
+			source:   "# nothing\n\n# here\n",
+			expected: "# nothing\n\n# here\n",
+		},
+		{
+			name:     "an empty file",
+			source:   "\n\n",
+			expected: "",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			formatted, err := Source("test.mr", test.source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if formatted != test.expected {
+				t.Errorf("expected\n%s\ngot\n%s", test.expected, formatted)
+			}
+			again, err := Source("test.mr", formatted)
+			if err != nil || again != formatted {
+				t.Errorf("formatting again changed it to\n%s\n%v", again, err)
+			}
+		})
+	}
+}
+
+// TestSourceIsStable formats every program in the repository twice, formatting a
+// formatted file must not change it, or fmt -w would keep rewriting files
+func TestSourceIsStable(t *testing.T) {
+	files, err := filepath.Glob("../*.mr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdlibFiles, err := filepath.Glob("../stdlib/*.mr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files = append(files, stdlibFiles...)
+	if len(files) == 0 {
+		t.Fatal("found no programs to format")
+	}
+
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			content, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			formatted, err := Source(file, string(content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			again, err := Source(file, formatted)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if again != formatted {
+				t.Errorf("formatting again changed it:\n%s", LabeledDiff("formatted", "formatted again", formatted, again))
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package format
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Run formats each file named in arguments, printing the result to stdout.
+// With -w each file is rewritten instead, and with -d the changes are printed
+// as a diff. Every file is formatted even if one fails, the errors are returned together
+func Run(arguments []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	write := flags.Bool("w", false, "write the formatted source back to each file, instead of printing it")
+	diff := flags.Bool("d", false, "print a diff of the changes formatting would make, instead of the formatted source")
+	if err := flags.Parse(arguments); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return errors.New("usage: morklerork fmt [-w] [-d] <program.mr>...")
+	}
+
+	formatErrors := make([]error, 0)
+	for _, fileName := range flags.Args() {
+		if err := formatFile(fileName, *write, *diff, stdout); err != nil {
+			formatErrors = append(formatErrors, err)
+		}
+	}
+	return errors.Join(formatErrors...)
+}
+
+func formatFile(fileName string, write bool, diff bool, stdout io.Writer) error {
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return err
+	}
+	formatted, err := Source(fileName, string(content))
+	if err != nil {
+		return err
+	}
+
+	if diff {
+		fmt.Fprint(stdout, Diff(fileName, string(content), formatted))
+	}
+	if write {
+		if formatted == string(content) {
+			return nil
+		}
+		info, err := os.Stat(fileName)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(fileName, []byte(formatted), info.Mode().Perm())
+	}
+	if !diff {
+		fmt.Fprint(stdout, formatted)
+	}
+	return nil
+}
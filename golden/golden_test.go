@@ -0,0 +1,40 @@
+package golden
+
+import (
+	"bytes"
+	"morklerork/runflags"
+	"os"
+	"testing"
+)
+
+// TestGolden checks every program in the repository root against its golden
+// file, on both engines, so a change to what a program prints is caught
+func TestGolden(t *testing.T) {
+	// golden files name programs as they are named from the root, such as in errors
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(".."); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	engines := []struct {
+		name       string
+		treeWalker bool
+	}{
+		{"bytecode", false},
+		{"treewalker", true},
+	}
+	for _, engine := range engines {
+		t.Run(engine.name, func(t *testing.T) {
+			runFlags := runflags.New()
+			runFlags.TreeWalker = engine.treeWalker
+			var output bytes.Buffer
+			if err := Run(nil, &output, runFlags); err != nil {
+				t.Errorf("%v\n%s", err, output.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package golden
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"morklerork/executor"
+	"morklerork/format"
+	"morklerork/loader"
+	"morklerork/runflags"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// goldenSuffix replaces .mr in the name of the file holding a program's expected output
+const goldenSuffix = ".golden"
+
+// stdinSuffix replaces .mr in the name of the file given to a program as stdin
+const stdinSuffix = ".stdin"
+
+type checker struct {
+	stdout   io.Writer
+	heapSize int
+	options  executor.Options
+	update   bool
+
+	matched int
+	failed  int
+}
+
+// Run checks each program named in arguments against its golden file, or every
+// program with a golden file in the current directory if none are named.
+// A program, such as heaptest.mr, is run with heaptest.stdin as its stdin if
+// that exists, or an empty stdin if not, and what it writes to stdout,
+// followed by the error it stopped with if any, must be the same as
+// heaptest.golden. A directory checks every program in it with a golden file.
+// With -update the golden files are written from the output instead, which
+// is how one is made for a new program. The result of each program is
+// printed to stdout, and an error is returned if any did not match.
+// The flags from runFlags can be given too, and apply to every program
+func Run(arguments []string, stdout io.Writer, runFlags *runflags.Flags) error {
+	flags := flag.NewFlagSet("check-golden", flag.ContinueOnError)
+	update := flags.Bool("update", false, "write each program's output to its golden file, instead of checking it")
+	runFlags.Register(flags)
+	if err := flags.Parse(arguments); err != nil {
+		return err
+	}
+	options, err := runFlags.Options()
+	if err != nil {
+		return err
+	}
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	programs, err := goldenPrograms(paths)
+	if err != nil {
+		return err
+	}
+	if len(programs) == 0 {
+		return errors.New("no programs with " + goldenSuffix + " files found in " + strings.Join(paths, " "))
+	}
+
+	checker := &checker{stdout: stdout, heapSize: runFlags.HeapSize, options: options, update: *update}
+	for _, program := range programs {
+		if err := checker.check(program); err != nil {
+			return err
+		}
+	}
+	err = runFlags.Report(options, stdout)
+	if checker.failed > 0 {
+		return errors.Join(fmt.Errorf("%d of %d programs did not match their golden files", checker.failed, checker.matched+checker.failed), err)
+	}
+	return err
+}
+
+// goldenPrograms finds the programs to check in each path, a directory gives
+// every .mr file directly inside it that has a golden file, and a file is used as it is
+func goldenPrograms(paths []string) ([]string, error) {
+	programs := make([]string, 0)
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			programs = append(programs, path)
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(path, "*.mr"))
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(matches)
+		for _, match := range matches {
+			if _, err := os.Stat(sibling(match, goldenSuffix)); err == nil {
+				programs = append(programs, match)
+			}
+		}
+	}
+	return programs, nil
+}
+
+// sibling is the name of the file next to program with suffix in place of .mr
+func sibling(program string, suffix string) string {
+	return strings.TrimSuffix(program, ".mr") + suffix
+}
+
+// check runs a program and compares or updates its golden file. Only a
+// problem reading or writing files is returned, a mismatch is counted and printed
+func (checker *checker) check(program string) error {
+	output, err := checker.output(program)
+	if err != nil {
+		return err
+	}
+	goldenFile := sibling(program, goldenSuffix)
+
+	if checker.update {
+		if err := os.WriteFile(goldenFile, []byte(output), 0644); err != nil {
+			return err
+		}
+		checker.matched++
+		fmt.Fprintf(checker.stdout, "updated %s\n", goldenFile)
+		return nil
+	}
+
+	expected, err := os.ReadFile(goldenFile)
+	if errors.Is(err, os.ErrNotExist) {
+		checker.failed++
+		fmt.Fprintf(checker.stdout, "FAIL %s\n    %s does not exist, run check-golden -update %s to create it\n", program, goldenFile, program)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if string(expected) != output {
+		checker.failed++
+		fmt.Fprintf(checker.stdout, "FAIL %s\n%s", program, format.LabeledDiff(goldenFile, program+" (output)", string(expected), output))
+		return nil
+	}
+	checker.matched++
+	fmt.Fprintf(checker.stdout, "ok   %s\n", program)
+	return nil
+}
+
+// output runs a program in a new Interpreter with its scripted stdin, giving
+// everything it logged and the error it stopped with, as a terminal would show them
+func (checker *checker) output(program string) (string, error) {
+	stdin, err := os.ReadFile(sibling(program, stdinSuffix))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+
+	var output bytes.Buffer
+	commands, err := loader.Load(program)
+	if err == nil {
+		interpreter := executor.NewInterpreter(bytes.NewReader(stdin), &output, checker.heapSize, checker.options)
+		err = interpreter.Execute(commands)
+	}
+	if err != nil {
+		fmt.Fprintln(&output, err)
+	}
+	return output.String(), nil
+}
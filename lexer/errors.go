@@ -0,0 +1,25 @@
+package lexer
+
+import "morklerork/symbols"
+
+// LexErrorKind is what went wrong in a LexError, so callers can react
+// to a class of problem without matching on the message
+type LexErrorKind int
+
+const (
+	EmptySymbolError LexErrorKind = iota
+	BoolLiteralError
+	StringLiteralError
+	UnrecognisedSymbolError
+)
+
+// LexError is returned by Lex for any line that could not be turned into Symbols
+type LexError struct {
+	Pos     symbols.Position
+	Kind    LexErrorKind
+	Message string
+}
+
+func (err *LexError) Error() string {
+	return err.Pos.String() + ": " + err.Message
+}
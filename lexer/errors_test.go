@@ -0,0 +1,31 @@
+package lexer
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLexErrorKind(t *testing.T) {
+	tests := []struct {
+		name    string
+		program string
+		kind    LexErrorKind
+		message string
+	}{
+		{"an empty symbol", "log  'a'\n", EmptySymbolError, "test.mr:1:5: Empty symbol, symbols should be separated by exactly one space"},
+		{"a bool literal", "log ?maybe\n", BoolLiteralError, "test.mr:1:5: Bool literal should either be `?true` or ?false`"},
+		{"an unrecognised symbol", "log a\n", UnrecognisedSymbolError, "test.mr:1:5: Unrecognised symbol: a, did you mean to use a variable? try `:a`, or a string? try `'a'`"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Lex("test.mr", test.program)
+			var lexErr *LexError
+			if !errors.As(err, &lexErr) || lexErr.Kind != test.kind {
+				t.Fatalf("expected a LexError of kind %d, got %v", test.kind, err)
+			}
+			if err.Error() != test.message {
+				t.Errorf("expected %q, got %q", test.message, err.Error())
+			}
+		})
+	}
+}
@@ -1,16 +1,25 @@
 package lexer
 
 import (
-	"log"
+	"errors"
 	"morklerork/symbols"
 	"strconv"
 	"strings"
 )
 
+// A symbol that has been split out of a line, but not yet lexed
+// column is where the symbol started in the line, counting from 1
+type rawSymbol struct {
+	text   string
+	column int
+}
+
 // If not for strings with spaces in them, we could just split on ' '
 // Instead go rune by rune, keeping track of if we are
 // in a string or not
-func splitIntoSymbols(line []rune) []string {
+// Parentheses and heap access brackets are also split into symbols of their
+// own, even when there is no space around them, unless they are in a string
+func splitIntoSymbols(line []rune, startColumn int) []rawSymbol {
 	// rune queue to process one by one
 	runeQueue := line[:]
 
@@ -18,9 +27,17 @@ func splitIntoSymbols(line []rune) []string {
 	santizedSymbols := []strings.Builder{
 		{},
 	}
+	// the column each of the santizedSymbols started at
+	columns := []int{
+		startColumn,
+	}
+	column := startColumn
 
 	lastSeenRune := '\000'
 	isInString := false
+	// set after a parenthesis or bracket has been split off, so that a space
+	// after it does not start another empty symbol
+	isAfterBracket := false
 	for len(runeQueue) > 0 {
 		if runeQueue[0] == '\'' { // we see a quote, starting or ending a string literal
 			if !isInString { // we are not in a string, so start one
@@ -37,29 +54,57 @@ func splitIntoSymbols(line []rune) []string {
 					lastSeenRune = runeQueue[0]
 				}
 			}
+			isAfterBracket = false
 		} else if runeQueue[0] == ' ' { // we have seen a space
 			if isInString { // in a string, preserve the space for the string
 				santizedSymbols[len(santizedSymbols)-1].WriteRune(runeQueue[0])
 				lastSeenRune = runeQueue[0]
+			} else if isAfterBracket { // a symbol was already started after the bracket, just move it along
+				columns[len(columns)-1] = column + 1
 			} else { // we are not in a string, start a new symbol
 				santizedSymbols = append(santizedSymbols, strings.Builder{})
+				columns = append(columns, column+1)
+			}
+		} else if isBracket(runeQueue[0]) && !isInString {
+			// a parenthesis or bracket is always a symbol on its own
+			if santizedSymbols[len(santizedSymbols)-1].Len() > 0 {
+				santizedSymbols = append(santizedSymbols, strings.Builder{})
+				columns = append(columns, column)
+			} else {
+				columns[len(columns)-1] = column
 			}
+			santizedSymbols[len(santizedSymbols)-1].WriteRune(runeQueue[0])
+			santizedSymbols = append(santizedSymbols, strings.Builder{})
+			columns = append(columns, column+1)
+			lastSeenRune = runeQueue[0]
+			isAfterBracket = true
 		} else { // any other caracter, write the rune into the symbol
 			santizedSymbols[len(santizedSymbols)-1].WriteRune(runeQueue[0])
 			lastSeenRune = runeQueue[0]
+			isAfterBracket = false
 		}
 
 		runeQueue = runeQueue[1:]
+		column++
+	}
+
+	// a line ending in a bracket leaves an empty symbol after it
+	if isAfterBracket && santizedSymbols[len(santizedSymbols)-1].Len() == 0 {
+		santizedSymbols = santizedSymbols[:len(santizedSymbols)-1]
 	}
 
 	// convert the builders into strings
-	programSymbols := make([]string, 0)
-	for _, symbol := range santizedSymbols {
-		programSymbols = append(programSymbols, symbol.String())
+	programSymbols := make([]rawSymbol, 0)
+	for i, symbol := range santizedSymbols {
+		programSymbols = append(programSymbols, rawSymbol{text: symbol.String(), column: columns[i]})
 	}
 	return programSymbols
 }
 
+func isBracket(r rune) bool {
+	return r == '(' || r == ')' || r == '[' || r == ']'
+}
+
 func lexIndent(line []rune) (int, []rune) {
 	indent := 0
 	for len(line) > 0 && line[0] == ' ' {
@@ -69,98 +114,124 @@ func lexIndent(line []rune) (int, []rune) {
 	return indent, line
 }
 
-func lexLiteralsAndUserDefinedSymbols(symbol string) symbols.Symbol {
+func lexLiteralsAndUserDefinedSymbols(symbol string, pos symbols.Position) (symbols.Symbol, error) {
+	if symbol == "" {
+		return nil, &LexError{Pos: pos, Kind: EmptySymbolError, Message: "Empty symbol, symbols should be separated by exactly one space"}
+	}
 	if symbol[0] == ':' {
-		return symbols.VariableName{Name: symbol}
+		return symbols.VariableName{Name: symbol, Pos: pos}, nil
 	} else if symbol[0] == '$' {
-		return symbols.ProgramName{Name: symbol}
+		return symbols.ProgramName{Name: symbol, Pos: pos}, nil
 	} else if symbol[0] == '?' {
 		if symbol[1:] == "true" {
-			return symbols.BooleanLiteral{Value: true}
+			return symbols.BooleanLiteral{Value: true, Pos: pos}, nil
 		} else if symbol[1:] == "false" {
-			return symbols.BooleanLiteral{Value: false}
-		} else {
-			log.Fatal("Bool literal should either be `?true` or ?false`")
+			return symbols.BooleanLiteral{Value: false, Pos: pos}, nil
 		}
-	} else if symbol[0] == '\'' && symbol[len(symbol)-1] == '\'' {
+		return nil, &LexError{Pos: pos, Kind: BoolLiteralError, Message: "Bool literal should either be `?true` or ?false`"}
+	} else if len(symbol) > 1 && symbol[0] == '\'' && symbol[len(symbol)-1] == '\'' {
 		unescapedString := strings.Replace(symbol[1:len(symbol)-1], "\\'", "'", -1)
 		stringVal, err := strconv.Unquote(`"` + unescapedString + `"`)
 		if err != nil {
-			log.Println(err.Error())
-			log.Fatal(err)
+			return nil, &LexError{Pos: pos, Kind: StringLiteralError, Message: "Invalid string literal " + symbol + ": " + err.Error()}
 		}
-		return symbols.StringLiteral{Value: stringVal}
-	} else if symbol[0] == '[' && symbol[len(symbol)-1] == ']' {
-		innerSymbol := lexSymbol(symbol[1 : len(symbol)-1])
-		return symbols.HeapAccess{IndexExpressionSymbol: innerSymbol}
+		return symbols.StringLiteral{Value: stringVal, Pos: pos}, nil
 	} else if num, err := strconv.Atoi(symbol); err == nil {
-		return symbols.IntLiteral{Value: num}
-	} else {
-		log.Fatal("Unrecognised symbol: " + symbol + ", did you mean to use a variable? try `:" + symbol + "`, or a string? try `'" + symbol + "'`")
+		return symbols.IntLiteral{Value: num, Pos: pos}, nil
 	}
+	return nil, &LexError{Pos: pos, Kind: UnrecognisedSymbolError, Message: "Unrecognised symbol: " + symbol + ", did you mean to use a variable? try `:" + symbol + "`, or a string? try `'" + symbol + "'`"}
+}
 
-	// this is unreachable, why is it needed?
-	return nil
+// Quote writes a string as a string literal, the way lexLiteralsAndUserDefinedSymbols reads one
+func Quote(value string) string {
+	quoted := strconv.Quote(value)
+	return "'" + strings.ReplaceAll(quoted[1:len(quoted)-1], "'", `\'`) + "'"
 }
 
-func lexSymbol(symbol string) symbols.Symbol {
+func lexSymbol(symbol string, pos symbols.Position) (symbols.Symbol, error) {
 	switch symbol {
 	// CommandSymbols
 	case "log":
-		return symbols.Print{}
+		return symbols.Print{Pos: pos}, nil
 	case "read":
-		return symbols.Read{}
+		return symbols.Read{Pos: pos}, nil
 	case "=":
-		return symbols.Assign{}
+		return symbols.Assign{Pos: pos}, nil
 	case "new":
-		return symbols.Define{}
+		return symbols.Define{Pos: pos}, nil
 	case "if":
-		return symbols.If{}
+		return symbols.If{Pos: pos}, nil
+	case "elif":
+		return symbols.ElseIf{Pos: pos}, nil
+	case "else":
+		return symbols.Else{Pos: pos}, nil
 	case "while":
-		return symbols.While{}
+		return symbols.While{Pos: pos}, nil
 	case "program":
-		return symbols.Program{}
+		return symbols.Program{Pos: pos}, nil
 	case "call":
-		return symbols.Call{}
+		return symbols.Call{Pos: pos}, nil
 	case "return":
-		return symbols.Return{}
+		return symbols.Return{Pos: pos}, nil
+	case "break":
+		return symbols.Break{Pos: pos}, nil
+	case "continue":
+		return symbols.Continue{Pos: pos}, nil
+	case "import":
+		return symbols.Import{Pos: pos}, nil
+	case "assert":
+		return symbols.Assert{Pos: pos}, nil
+	// Parentheses
+	case "(":
+		return symbols.OpenParenthesis{Pos: pos}, nil
+	case ")":
+		return symbols.CloseParenthesis{Pos: pos}, nil
+	// HeapAccess brackets
+	case "[":
+		return symbols.OpenHeapAccess{Pos: pos}, nil
+	case "]":
+		return symbols.CloseHeapAccess{Pos: pos}, nil
 	// OperatorSymbols
 	case "&":
-		return symbols.BinaryOperator{BinaryOperatorType: symbols.LogicalAndOperator}
+		return symbols.BinaryOperator{BinaryOperatorType: symbols.LogicalAndOperator, Pos: pos}, nil
 	case "|":
-		return symbols.BinaryOperator{BinaryOperatorType: symbols.LogicalOrOperator}
+		return symbols.BinaryOperator{BinaryOperatorType: symbols.LogicalOrOperator, Pos: pos}, nil
 	case "==":
-		return symbols.BinaryOperator{BinaryOperatorType: symbols.EqualOperator}
+		return symbols.BinaryOperator{BinaryOperatorType: symbols.EqualOperator, Pos: pos}, nil
 	case "!=":
-		return symbols.BinaryOperator{BinaryOperatorType: symbols.NotEqualOperator}
+		return symbols.BinaryOperator{BinaryOperatorType: symbols.NotEqualOperator, Pos: pos}, nil
 	case "<":
-		return symbols.BinaryOperator{BinaryOperatorType: symbols.LTOperator}
+		return symbols.BinaryOperator{BinaryOperatorType: symbols.LTOperator, Pos: pos}, nil
 	case "+":
-		return symbols.BinaryOperator{BinaryOperatorType: symbols.PlusOperator}
+		return symbols.BinaryOperator{BinaryOperatorType: symbols.PlusOperator, Pos: pos}, nil
 	case "-":
-		return symbols.BinaryOperator{BinaryOperatorType: symbols.MinusOperator}
+		return symbols.BinaryOperator{BinaryOperatorType: symbols.MinusOperator, Pos: pos}, nil
 	case "*":
-		return symbols.BinaryOperator{BinaryOperatorType: symbols.TimesOperator}
+		return symbols.BinaryOperator{BinaryOperatorType: symbols.TimesOperator, Pos: pos}, nil
 	case "/":
-		return symbols.BinaryOperator{BinaryOperatorType: symbols.DivideOperator}
+		return symbols.BinaryOperator{BinaryOperatorType: symbols.DivideOperator, Pos: pos}, nil
 	case "%":
-		return symbols.BinaryOperator{BinaryOperatorType: symbols.ModuloOperator}
+		return symbols.BinaryOperator{BinaryOperatorType: symbols.ModuloOperator, Pos: pos}, nil
 	// literals and user defined symbols
 	default:
-		return lexLiteralsAndUserDefinedSymbols(symbol)
+		return lexLiteralsAndUserDefinedSymbols(symbol, pos)
 	}
-	// This is unreachable, why is it needed?
-	return nil
 }
 
-func Lex(programString string) [][]symbols.Symbol {
+// Lex
+// Lex a single file into lines of Symbols.
+// fileName is only used to give each Symbol a Position
+// Lexing carries on past a bad line, so that every LexError in the file
+// is returned together
+func Lex(fileName string, programString string) ([][]symbols.Symbol, error) {
 	program := make([][]symbols.Symbol, 0)
+	lexErrors := make([]error, 0)
 	programLines := strings.Split(programString, "\n")
-	for _, line := range programLines {
+	for lineIndex, line := range programLines {
 		if line == "" { // ignore blank lines
 			continue
 		}
-		if line[0] == '#' { // ignore comments
+		if strings.HasPrefix(strings.TrimLeft(line, " "), "#") { // ignore comments, however they are indented
 			continue
 		}
 		indent, unindentedLine := lexIndent([]rune(line))
@@ -168,14 +239,27 @@ func Lex(programString string) [][]symbols.Symbol {
 			continue
 		}
 
+		linePos := symbols.Position{File: fileName, Line: lineIndex + 1, Column: 1}
+
 		programCommand := make([]symbols.Symbol, 0)
 
-		programCommand = append(programCommand, symbols.Indent{Level: indent})
+		programCommand = append(programCommand, symbols.Indent{Level: indent, Pos: linePos})
 
-		for _, symbol := range splitIntoSymbols(unindentedLine) {
-			programCommand = append(programCommand, lexSymbol(symbol))
+		lineIsValid := true
+		for _, symbol := range splitIntoSymbols(unindentedLine, indent+1) {
+			pos := linePos
+			pos.Column = symbol.column
+			lexedSymbol, err := lexSymbol(symbol.text, pos)
+			if err != nil {
+				lexErrors = append(lexErrors, err)
+				lineIsValid = false
+				break
+			}
+			programCommand = append(programCommand, lexedSymbol)
+		}
+		if lineIsValid {
+			program = append(program, programCommand)
 		}
-		program = append(program, programCommand)
 	}
-	return program
+	return program, errors.Join(lexErrors...)
 }
@@ -0,0 +1,30 @@
+package loader
+
+import "morklerork/symbols"
+
+// LoadErrorKind is what went wrong in a LoadError
+type LoadErrorKind int
+
+const (
+	FileError LoadErrorKind = iota
+	ImportError
+	ImportCycleError
+	ModuleNameError
+	VisibilityError
+)
+
+// LoadError is returned by Load when a module can not be found, or its
+// imports and names break the module rules
+type LoadError struct {
+	Pos     symbols.Position
+	Kind    LoadErrorKind
+	Message string
+}
+
+func (err *LoadError) Error() string {
+	return err.Pos.String() + ": " + err.Message
+}
+
+func newLoadError(pos symbols.Position, kind LoadErrorKind, message string) *LoadError {
+	return &LoadError{Pos: pos, Kind: kind, Message: message}
+}
@@ -1,23 +1,259 @@
 package loader
 
 import (
-	"log"
+	"errors"
+	"morklerork/ast"
+	"morklerork/lexer"
+	"morklerork/parser"
 	"morklerork/stdlib"
 	"os"
+	"path/filepath"
+	"strings"
 )
 
-func Load() string {
-	programNames := os.Args[1:]
+// module is one file, loaded once no matter how many files import it
+type module struct {
+	// name is the prefix other modules reach its programs and variables through,
+	// it is empty for the entry file
+	name     string
+	file     string
+	commands []ast.Command
+	// imports are the names of the modules this file imports directly
+	imports map[string]bool
+}
+
+// loadingModule is a module whose imports are still being loaded
+type loadingModule struct {
+	key  string
+	file string
+}
+
+type loader struct {
+	// modules that have finished loading, by the absolute path of their
+	// file, or stdlib: followed by the name for stdlib modules
+	modules map[string]*module
+	// modules currently being loaded, innermost last, an import of one
+	// of these is an import cycle
+	loading []loadingModule
+	// the file each module name was taken by
+	names map[string]string
+	// modules in the order they should be executed, each after its imports
+	order  []*module
+	errors []error
+}
+
+// Load reads the entry program and every module it imports, returning one
+// program where each module is executed once, after the modules it imports
+func Load(entryName string) ([]ast.Command, error) {
+	content, err := os.ReadFile(entryName)
+	if err != nil {
+		return nil, err
+	}
+
+	loader := &loader{
+		modules: make(map[string]*module),
+		names:   make(map[string]string),
+	}
+	loader.loadModule(fileKey(entryName), "", entryName, string(content))
+	if len(loader.errors) > 0 {
+		return nil, errors.Join(loader.errors...)
+	}
+
+	program := make([]ast.Command, 0)
+	for _, module := range loader.order {
+		loader.checkNames(module)
+		program = append(program, module.commands...)
+	}
+	if len(loader.errors) > 0 {
+		return nil, errors.Join(loader.errors...)
+	}
+	return program, nil
+}
+
+func fileKey(file string) string {
+	absolute, err := filepath.Abs(file)
+	if err != nil {
+		return filepath.Clean(file)
+	}
+	return absolute
+}
+
+// loadModule lexes and parses one file, then loads everything it imports
+// It returns nil if the file, or anything it imports, could not be loaded
+func (loader *loader) loadModule(key string, name string, file string, content string) *module {
+	loader.loading = append(loader.loading, loadingModule{key: key, file: file})
+	defer func() {
+		loader.loading = loader.loading[:len(loader.loading)-1]
+	}()
+
+	fileSymbols, err := lexer.Lex(file, content)
+	if err != nil {
+		loader.errors = append(loader.errors, err)
+		return nil
+	}
+	commands, _, err := parser.ParseBlock(fileSymbols, 0)
+	if err != nil {
+		loader.errors = append(loader.errors, err)
+		return nil
+	}
+
+	module := &module{
+		name:     name,
+		file:     file,
+		commands: make([]ast.Command, 0, len(commands)),
+		imports:  make(map[string]bool),
+	}
+	if !loader.addCommands(module, commands) {
+		return nil
+	}
+
+	loader.modules[key] = module
+	loader.order = append(loader.order, module)
+	return module
+}
+
+// addCommands loads everything imported by commands, adding the rest of the
+// commands to the module. It returns false if any import could not be loaded
+func (loader *loader) addCommands(module *module, commands []ast.Command) bool {
+	isValid := true
+	for _, command := range commands {
+		importCommand, ok := command.(ast.Import)
+		if !ok {
+			module.commands = append(module.commands, command)
+			continue
+		}
+		imported := loader.loadImport(importCommand, module.file)
+		if imported == nil {
+			isValid = false
+			continue
+		}
+		module.imports[imported.name] = true
+	}
+	return isValid
+}
+
+// loadImport finds the module an import refers to, loading it if this is
+// the first time it has been imported
+func (loader *loader) loadImport(importCommand ast.Import, importerFile string) *module {
+	var key, file, content string
+	isStdlib := !strings.HasSuffix(importCommand.Path, ".mr")
+	if isStdlib {
+		libFile, ok := stdlib.Lookup(importCommand.Path)
+		if !ok {
+			loader.errors = append(loader.errors, newLoadError(importCommand.Pos, ImportError, "there is no stdlib module named "+importCommand.Path+", paths to files must end in .mr"))
+			return nil
+		}
+		key, file, content = "stdlib:"+importCommand.Path, libFile.Name, libFile.Content
+	} else {
+		file = filepath.Join(filepath.Dir(importerFile), importCommand.Path)
+		key = fileKey(file)
+	}
 
-	programString := ""
+	if module, ok := loader.modules[key]; ok {
+		return module
+	}
 
-	for _, name := range programNames {
-		content, err := os.ReadFile(name)
+	for i, loading := range loader.loading {
+		if loading.key == key {
+			cycle := make([]string, 0)
+			for _, inCycle := range loader.loading[i:] {
+				cycle = append(cycle, inCycle.file)
+			}
+			cycle = append(cycle, file)
+			loader.errors = append(loader.errors, newLoadError(importCommand.Pos, ImportCycleError, "import cycle: "+strings.Join(cycle, " imports ")))
+			return nil
+		}
+	}
+
+	name := strings.TrimSuffix(filepath.Base(file), ".mr")
+	if name == "" || strings.ContainsAny(name, "$: ") || strings.Contains(name, "__") {
+		loader.errors = append(loader.errors, newLoadError(importCommand.Pos, ImportError, file+" can not be imported, "+name+" is not a valid module name"))
+		return nil
+	}
+	if otherFile, ok := loader.names[name]; ok {
+		loader.errors = append(loader.errors, newLoadError(importCommand.Pos, ImportError, "can not import "+file+", the module name "+name+" is already used by "+otherFile))
+		return nil
+	}
+
+	if !isStdlib {
+		fileContent, err := os.ReadFile(file)
 		if err != nil {
-			log.Fatal(err)
+			loader.errors = append(loader.errors, newLoadError(importCommand.Pos, FileError, err.Error()))
+			return nil
 		}
-		programString += "\n" + string(content)
+		content = string(fileContent)
 	}
 
-	return stdlib.LoadStdLibFiles() + programString
+	loader.names[name] = file
+	module := loader.loadModule(key, name, file, content)
+	if module == nil {
+		// free the name, so fixing the file and importing it again works
+		delete(loader.names, name)
+	}
+	return module
+}
+
+// Session loads the modules imported by a program that is given one piece at
+// a time, such as in the repl. A module imported by an earlier piece is not
+// loaded or executed again
+type Session struct {
+	loader *loader
+	// imports made by every piece so far, they all share one namespace
+	imports map[string]bool
+	file    string
+}
+
+// NewSession creates a Session where imports are resolved as if every
+// piece was part of file
+func NewSession(file string) *Session {
+	return &Session{
+		loader: &loader{
+			modules: make(map[string]*module),
+			names:   make(map[string]string),
+		},
+		imports: make(map[string]bool),
+		file:    file,
+	}
+}
+
+// Add loads everything newly imported by commands, returning the commands of
+// those modules followed by the rest of commands, ready to be executed
+// If anything fails to load, the Session is left as it was before
+func (session *Session) Add(commands []ast.Command) ([]ast.Command, error) {
+	loader := session.loader
+	loader.errors = nil
+	loader.loading = []loadingModule{{key: session.file, file: session.file}}
+	start := len(loader.order)
+
+	imports := make(map[string]bool)
+	for name := range session.imports {
+		imports[name] = true
+	}
+	piece := &module{file: session.file, imports: imports}
+	if loader.addCommands(piece, commands) {
+		for _, module := range loader.order[start:] {
+			loader.checkNames(module)
+		}
+		loader.checkNames(piece)
+	}
+
+	if len(loader.errors) > 0 {
+		for _, module := range loader.order[start:] {
+			delete(loader.names, module.name)
+			for key, cached := range loader.modules {
+				if cached == module {
+					delete(loader.modules, key)
+				}
+			}
+		}
+		loader.order = loader.order[:start]
+		return nil, errors.Join(loader.errors...)
+	}
+
+	session.imports = imports
+	program := make([]ast.Command, 0)
+	for _, module := range loader.order[start:] {
+		program = append(program, module.commands...)
+	}
+	return append(program, piece.commands...), nil
 }
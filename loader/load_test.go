@@ -0,0 +1,107 @@
+package loader
+
+import (
+	"bytes"
+	"errors"
+	"morklerork/executor"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeFiles writes each file into a new directory, returning the path of main.mr
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	directory := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(directory, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return filepath.Join(directory, "main.mr")
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		kind    LoadErrorKind
+		message string
+	}{
+		{
+			name: "an import cycle",
+			files: map[string]string{
+				"main.mr":   "import 'first.mr'\n",
+				"first.mr":  "import 'second.mr'\n",
+				"second.mr": "import 'first.mr'\n",
+			},
+			kind:    ImportCycleError,
+			message: "second.mr:1:1: import cycle: first.mr imports second.mr imports first.mr",
+		},
+		{
+			name: "a private program",
+			files: map[string]string{
+				"main.mr": "import 'lib.mr'\ncall $lib__secret\n",
+				"lib.mr":  "program $lib__secret\n    log 'secret'\n",
+			},
+			kind:    VisibilityError,
+			message: "main.mr:2:6: $lib__secret is private to module lib",
+		},
+		{
+			name: "a module that is not imported",
+			files: map[string]string{
+				"main.mr":  "import 'other.mr'\ncall $lib$shared\n",
+				"other.mr": "import 'lib.mr'\n",
+				"lib.mr":   "program $lib$shared\n    log 'shared'\n",
+			},
+			kind:    VisibilityError,
+			message: "main.mr:2:6: $lib$shared belongs to module lib, which is not imported by main.mr",
+		},
+		{
+			name: "a program named for another module",
+			files: map[string]string{
+				"main.mr": "import 'lib.mr'\n",
+				"lib.mr":  "program $helper\n    log 'helper'\n",
+			},
+			kind:    ModuleNameError,
+			message: "lib.mr:1:9: $helper is defined in module lib, so it must be named $lib$<name>, or $lib__<name> to keep it private",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			main := writeFiles(t, test.files)
+			_, err := Load(main)
+			var loadErr *LoadError
+			if !errors.As(err, &loadErr) || loadErr.Kind != test.kind {
+				t.Fatalf("expected a LoadError of kind %d, got %v", test.kind, err)
+			}
+			// the files are named from the directory they were written to
+			message := strings.ReplaceAll(err.Error(), filepath.Dir(main)+string(filepath.Separator), "")
+			if message != test.message {
+				t.Errorf("expected %q, got %q", test.message, message)
+			}
+		})
+	}
+}
+
+func TestModuleImportedTwiceRunsOnce(t *testing.T) {
+	main := writeFiles(t, map[string]string{
+		"main.mr":  "import 'lib.mr'\nimport 'other.mr'\ncall $lib$greet\ncall $other$greet\n",
+		"other.mr": "import 'lib.mr'\nprogram $other$greet\n    call $lib$greet\n",
+		"lib.mr":   "log 'lib loaded\\n'\nprogram $lib$greet\n    log 'hello\\n'\n",
+	})
+	commands, err := Load(main)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var output bytes.Buffer
+	interpreter := executor.NewInterpreter(strings.NewReader(""), &output, executor.DefaultHeapSize, executor.Options{})
+	if err := interpreter.Execute(commands); err != nil {
+		t.Fatal(err)
+	}
+	if output.String() != "lib loaded\nhello\nhello\n" {
+		t.Errorf("expected lib to run once before main, got %q", output.String())
+	}
+}
@@ -0,0 +1,139 @@
+package loader
+
+import (
+	"morklerork/ast"
+	"morklerork/symbols"
+	"strings"
+)
+
+// Programs and top level variables in a module must be named with the module
+// as a prefix, `$heap$new` is public while `$heap__getBlockSize` is private
+// to the heap module. Names like these can only be used from a file that
+// imports the module, so nothing from another module is reachable by accident.
+//
+// Variables inside a program are local to it, so they are never checked
+
+// qualifier finds the module a program or variable name belongs to. Names
+// that do not start with the prefix of a loaded module belong to no module
+func (loader *loader) qualifier(name string) (moduleName string, isPrivate bool, ok bool) {
+	unprefixed := name[1:]
+	for i := 1; i < len(unprefixed); i++ {
+		if unprefixed[i] == '$' {
+			moduleName = unprefixed[:i]
+			break
+		}
+		if strings.HasPrefix(unprefixed[i:], "__") {
+			moduleName, isPrivate = unprefixed[:i], true
+			break
+		}
+	}
+	if moduleName == "" {
+		return "", false, false
+	}
+	_, ok = loader.names[moduleName]
+	return moduleName, isPrivate, ok
+}
+
+// checkDefinition checks a module only defines names with its own prefix,
+// and the entry file does not define names with a module's prefix
+func (loader *loader) checkDefinition(module *module, name string, pos symbols.Position) {
+	moduleName, _, ok := loader.qualifier(name)
+	if module.name != "" {
+		if !ok || moduleName != module.name {
+			sigil := name[:1]
+			loader.errors = append(loader.errors, newLoadError(pos, ModuleNameError, name+" is defined in module "+module.name+", so it must be named "+sigil+module.name+"$<name>, or "+sigil+module.name+"__<name> to keep it private"))
+		}
+		return
+	}
+	if ok {
+		loader.errors = append(loader.errors, newLoadError(pos, ModuleNameError, name+" can only be defined in module "+moduleName))
+	}
+}
+
+// checkReference checks a name from another module is public, and that
+// module was imported by this file
+func (loader *loader) checkReference(module *module, name string, pos symbols.Position) {
+	moduleName, isPrivate, ok := loader.qualifier(name)
+	if !ok || moduleName == module.name {
+		return
+	}
+	if isPrivate {
+		loader.errors = append(loader.errors, newLoadError(pos, VisibilityError, name+" is private to module "+moduleName))
+		return
+	}
+	if !module.imports[moduleName] {
+		loader.errors = append(loader.errors, newLoadError(pos, VisibilityError, name+" belongs to module "+moduleName+", which is not imported by "+module.file))
+	}
+}
+
+func (loader *loader) checkNames(module *module) {
+	loader.checkCommands(module, module.commands, true, false)
+}
+
+func (loader *loader) checkCommands(module *module, commands []ast.Command, isTopLevel bool, isInProgram bool) {
+	for _, command := range commands {
+		switch command := command.(type) {
+		case ast.Log:
+			loader.checkExpression(module, command.Expr, isInProgram)
+		case ast.Read:
+			loader.checkExpression(module, command.Target, isInProgram)
+		case ast.New:
+			if isTopLevel {
+				loader.checkDefinition(module, command.VariableName, command.Pos)
+			} else if !isInProgram {
+				loader.checkReference(module, command.VariableName, command.Pos)
+			}
+			loader.checkExpression(module, command.Expr, isInProgram)
+		case ast.Assign:
+			loader.checkExpression(module, command.Target, isInProgram)
+			loader.checkExpression(module, command.Expr, isInProgram)
+		case ast.If:
+			loader.checkExpression(module, command.Cond, isInProgram)
+			loader.checkCommands(module, command.Commands, false, isInProgram)
+			for _, elseIf := range command.ElseIfs {
+				loader.checkExpression(module, elseIf.Cond, isInProgram)
+				loader.checkCommands(module, elseIf.Commands, false, isInProgram)
+			}
+			loader.checkCommands(module, command.Else.Commands, false, isInProgram)
+		case ast.While:
+			loader.checkExpression(module, command.Cond, isInProgram)
+			loader.checkCommands(module, command.Commands, false, isInProgram)
+		case ast.Program:
+			loader.checkDefinition(module, command.Name.Name, command.Name.Pos)
+			loader.checkCommands(module, command.Commands, false, true)
+		case ast.Call:
+			loader.checkReference(module, command.Name.Name, command.Name.Pos)
+			for _, expression := range command.Expressions {
+				loader.checkExpression(module, expression, isInProgram)
+			}
+			if command.HasReturnTarget {
+				loader.checkExpression(module, command.ReturnTarget, isInProgram)
+			}
+		case ast.Return:
+			if command.HasExpression {
+				loader.checkExpression(module, command.Expression, isInProgram)
+			}
+		case ast.Assert:
+			loader.checkExpression(module, command.Cond, isInProgram)
+			if command.HasMessage {
+				loader.checkExpression(module, command.Message, isInProgram)
+			}
+		case ast.Import:
+			loader.errors = append(loader.errors, newLoadError(command.Pos, ImportError, "import can only be used at the top level of a file, outside of any block"))
+		}
+	}
+}
+
+func (loader *loader) checkExpression(module *module, expression ast.Expression, isInProgram bool) {
+	switch expression := expression.(type) {
+	case ast.VariableName:
+		if !isInProgram {
+			loader.checkReference(module, expression.Name, expression.Pos)
+		}
+	case ast.HeapAccess:
+		loader.checkExpression(module, expression.IndexExpression, isInProgram)
+	case ast.BinaryOperator:
+		loader.checkExpression(module, expression.Lhs, isInProgram)
+		loader.checkExpression(module, expression.Rhs, isInProgram)
+	}
+}
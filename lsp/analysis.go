@@ -0,0 +1,254 @@
+package lsp
+
+import (
+	"morklerork/ast"
+	"morklerork/lexer"
+	"morklerork/parser"
+	"morklerork/symbols"
+	"strings"
+	"unicode/utf8"
+)
+
+// definition is where a program or variable is defined. pos is the position
+// of the name itself, so an editor can select it
+type definition struct {
+	name       string
+	pos        symbols.Position
+	parameters []string
+}
+
+// signature is how a program is written when it is called, such as `$heap$new :size`
+func (definition definition) signature() string {
+	return strings.Join(append([]string{definition.name}, definition.parameters...), " ")
+}
+
+// parse lexes and parses a whole file, returning false if it does not parse.
+// Lines that do not lex are left out, the commands around them are still useful
+func parse(file string, text string) ([]ast.Command, bool) {
+	fileSymbols, _ := lexer.Lex(file, text)
+	commands, _, err := parser.ParseBlock(fileSymbols, 0)
+	return commands, err == nil
+}
+
+// block is the commands under one header, such as an if, an elif or a program
+type block struct {
+	header   symbols.Position
+	indent   int
+	commands []ast.Command
+	// program is set for the block of a program, which can not see the variables around it
+	program *ast.Program
+}
+
+// blocksOf lists the blocks of a command in the order they are written
+func blocksOf(command ast.Command) []block {
+	switch command := command.(type) {
+	case ast.If:
+		blocks := []block{{header: command.Pos, indent: command.Indent, commands: command.Commands}}
+		for _, elseIf := range command.ElseIfs {
+			blocks = append(blocks, block{header: elseIf.Pos, indent: elseIf.Indent, commands: elseIf.Commands})
+		}
+		if command.HasElse {
+			blocks = append(blocks, block{header: command.Else.Pos, indent: command.Else.Indent, commands: command.Else.Commands})
+		}
+		return blocks
+	case ast.While:
+		return []block{{header: command.Pos, indent: command.Indent, commands: command.Commands}}
+	case ast.Program:
+		return []block{{header: command.Pos, indent: command.Indent, commands: command.Commands, program: &command}}
+	}
+	return nil
+}
+
+// lastLine is the line a block ends on, the line of its last command
+func (block block) lastLine() int {
+	if len(block.commands) == 0 {
+		return block.header.Line
+	}
+	last := block.commands[len(block.commands)-1]
+	if blocks := blocksOf(last); len(blocks) > 0 {
+		return blocks[len(blocks)-1].lastLine()
+	}
+	return ast.PositionOf(last).Line
+}
+
+func newDefinition(command ast.New) definition {
+	// the name is the symbol after `new `
+	pos := command.Pos
+	pos.Column += len("new ")
+	return definition{name: command.VariableName, pos: pos}
+}
+
+func programDefinition(program ast.Program) definition {
+	parameters := make([]string, 0, len(program.Parameters))
+	for _, parameter := range program.Parameters {
+		parameters = append(parameters, parameter.Name)
+	}
+	return definition{name: program.Name.Name, pos: program.Name.Pos, parameters: parameters}
+}
+
+// variablesAt lists the variables that can be used on a line, outermost first.
+// indent is how far the line is indented, a line after the last command of a
+// block is still in it while it is indented further than the block's header.
+// isInProgram is false at the top level, where imported variables can be used
+func variablesAt(commands []ast.Command, line int, indent int) (visible []definition, isInProgram bool) {
+	visible = make([]definition, 0)
+	for i, command := range commands {
+		if ast.PositionOf(command).Line >= line {
+			break
+		}
+		if newCommand, ok := command.(ast.New); ok {
+			visible = append(visible, newDefinition(newCommand))
+		}
+		if i+1 < len(commands) && ast.PositionOf(commands[i+1]).Line <= line {
+			continue
+		}
+
+		// the line is between this command and the next, so it may be in one of its blocks
+		blocks := blocksOf(command)
+		inBlock := -1
+		for j, block := range blocks {
+			if block.header.Line < line {
+				inBlock = j
+			}
+		}
+		if inBlock == -1 {
+			break
+		}
+		block := blocks[inBlock]
+		if inBlock == len(blocks)-1 && line > block.lastLine() && indent <= block.indent {
+			break
+		}
+
+		if block.program != nil {
+			visible = make([]definition, 0)
+			for _, parameter := range block.program.Parameters {
+				visible = append(visible, definition{name: parameter.Name, pos: parameter.Pos})
+			}
+			isInProgram = true
+		}
+		inner, innerIsInProgram := variablesAt(block.commands, line, indent)
+		return append(visible, inner...), isInProgram || innerIsInProgram
+	}
+	return visible, false
+}
+
+// declaredOn finds a variable declared by the command on a line, by `new` or as a parameter
+func declaredOn(commands []ast.Command, line int, name string) (definition, bool) {
+	for _, command := range commands {
+		pos := ast.PositionOf(command)
+		switch command := command.(type) {
+		case ast.New:
+			if pos.Line == line && command.VariableName == name {
+				return newDefinition(command), true
+			}
+		case ast.Program:
+			for _, parameter := range command.Parameters {
+				if pos.Line == line && parameter.Name == name {
+					return definition{name: parameter.Name, pos: parameter.Pos}, true
+				}
+			}
+		}
+		for _, block := range blocksOf(command) {
+			if definition, ok := declaredOn(block.commands, line, name); ok {
+				return definition, true
+			}
+		}
+	}
+	return definition{}, false
+}
+
+// programsIn lists every program defined in commands, including inside blocks
+func programsIn(commands []ast.Command) []definition {
+	programs := make([]definition, 0)
+	for _, command := range commands {
+		if program, ok := command.(ast.Program); ok {
+			programs = append(programs, programDefinition(program))
+		}
+		for _, block := range blocksOf(command) {
+			programs = append(programs, programsIn(block.commands)...)
+		}
+	}
+	return programs
+}
+
+// topLevelVariables lists the variables declared with `new` at the top level of a file
+func topLevelVariables(commands []ast.Command) []definition {
+	variables := make([]definition, 0)
+	for _, command := range commands {
+		if newCommand, ok := command.(ast.New); ok {
+			variables = append(variables, newDefinition(newCommand))
+		}
+	}
+	return variables
+}
+
+// wordAt finds the symbol around a character of a line, and where it starts.
+// Brackets are symbols of their own even when written against a name
+func wordAt(line string, character int) (string, int) {
+	runes := []rune(line)
+	if character > len(runes) {
+		character = len(runes)
+	}
+	isWordRune := func(r rune) bool {
+		return r != ' ' && r != '(' && r != ')' && r != '[' && r != ']'
+	}
+	start, end := character, character
+	for start > 0 && isWordRune(runes[start-1]) {
+		start--
+	}
+	for end < len(runes) && isWordRune(runes[end]) {
+		end++
+	}
+	return string(runes[start:end]), start
+}
+
+// before is the text of a line before a character
+func before(line string, character int) string {
+	runes := []rune(line)
+	if character > len(runes) {
+		character = len(runes)
+	}
+	return string(runes[:character])
+}
+
+// indentOf counts the spaces at the start of a line, the way the lexer does
+func indentOf(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// nameRange is the range a name takes up from its position
+func nameRange(pos symbols.Position, name string) textRange {
+	start := position{Line: pos.Line - 1, Character: pos.Column - 1}
+	end := start
+	end.Character += utf8.RuneCountInString(name)
+	return textRange{Start: start, End: end}
+}
+
+// argumentIndex finds which argument of a call is being written at the end of
+// text, a line up to the cursor. It returns the program being called, or false
+// if the cursor is not in the arguments of a call
+func argumentIndex(text string) (string, int, bool) {
+	fields := strings.Split(strings.TrimLeft(text, " "), " ")
+	if len(fields) < 2 || fields[0] != "call" {
+		return "", 0, false
+	}
+	fields = fields[1:]
+	if strings.HasPrefix(fields[0], ":") {
+		// the variable the result is returned to
+		fields = fields[1:]
+	}
+	if len(fields) < 2 || !strings.HasPrefix(fields[0], "$") {
+		return "", 0, false
+	}
+
+	// an argument in brackets has spaces inside it, so count arguments outside any
+	argument, depth := 0, 0
+	for _, field := range fields[1 : len(fields)-1] {
+		depth += strings.Count(field, "(") + strings.Count(field, "[") - strings.Count(field, ")") - strings.Count(field, "]")
+		if depth <= 0 {
+			argument++
+			depth = 0
+		}
+	}
+	return fields[0], argument, true
+}
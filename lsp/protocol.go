@@ -0,0 +1,134 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+)
+
+// The language server protocol sends JSON-RPC messages, each after a Content-Length header
+// https://microsoft.github.io/language-server-protocol/specifications/specification-current/
+
+// message is a request from the client, or a notification if it has no ID
+type message struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result"`
+	Error   *responseError  `json:"error,omitempty"`
+}
+
+type responseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// methodNotFound is the JSON-RPC error code for a request the server does not support
+const methodNotFound = -32601
+
+type notification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+func readMessage(input *bufio.Reader) (message, error) {
+	headers, err := textproto.NewReader(input).ReadMIMEHeader()
+	if err != nil {
+		return message{}, err
+	}
+	length, err := strconv.Atoi(headers.Get("Content-Length"))
+	if err != nil {
+		return message{}, fmt.Errorf("message has an invalid Content-Length: %w", err)
+	}
+
+	content := make([]byte, length)
+	if _, err := io.ReadFull(input, content); err != nil {
+		return message{}, err
+	}
+	var received message
+	if err := json.Unmarshal(content, &received); err != nil {
+		return message{}, err
+	}
+	return received, nil
+}
+
+func writeMessage(output io.Writer, sent interface{}) error {
+	content, err := json.Marshal(sent)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(output, "Content-Length: %d\r\n\r\n%s", len(content), content)
+	return err
+}
+
+// The parts of params and results this server uses. Lines and characters
+// count from 0, characters are counted in runes which matches UTF-16 for
+// anything outside string literals
+
+type position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type textRange struct {
+	Start position `json:"start"`
+	End   position `json:"end"`
+}
+
+type location struct {
+	URI   string    `json:"uri"`
+	Range textRange `json:"range"`
+}
+
+type textDocumentPosition struct {
+	TextDocument struct {
+		URI string `json:"uri"`
+	} `json:"textDocument"`
+	Position position `json:"position"`
+}
+
+type diagnostic struct {
+	Range    textRange `json:"range"`
+	Severity int       `json:"severity"`
+	Source   string    `json:"source"`
+	Message  string    `json:"message"`
+}
+
+// severityError marks a diagnostic as an error, rather than a warning
+const severityError = 1
+
+type completionItem struct {
+	Label    string   `json:"label"`
+	Kind     int      `json:"kind"`
+	Detail   string   `json:"detail,omitempty"`
+	TextEdit textEdit `json:"textEdit"`
+}
+
+// the completionItem kinds for programs and variables
+const (
+	functionKind = 3
+	variableKind = 6
+)
+
+type textEdit struct {
+	Range   textRange `json:"range"`
+	NewText string    `json:"newText"`
+}
+
+type signatureInformation struct {
+	Label      string                 `json:"label"`
+	Parameters []parameterInformation `json:"parameters"`
+}
+
+type parameterInformation struct {
+	Label string `json:"label"`
+}
@@ -0,0 +1,422 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"morklerork/ast"
+	"morklerork/executor"
+	"morklerork/lexer"
+	"morklerork/parser"
+	"morklerork/stdlib"
+	"morklerork/symbols"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// document is a file open in the editor
+type document struct {
+	uri  string
+	file string
+	text string
+	// commands are from the last time the text parsed, so a line being
+	// written does not stop completion working everywhere else
+	commands []ast.Command
+}
+
+func (document *document) line(line int) string {
+	lines := strings.Split(document.text, "\n")
+	if line < 0 || line >= len(lines) {
+		return ""
+	}
+	return strings.TrimRight(lines[line], "\r")
+}
+
+// commandsWithout parses the text with one line left out, the line being
+// written is usually not valid yet. If it still does not parse, the commands
+// from the last time it did are used
+func (document *document) commandsWithout(line int) []ast.Command {
+	lines := strings.Split(document.text, "\n")
+	if line >= 0 && line < len(lines) {
+		lines[line] = ""
+	}
+	if commands, ok := parse(document.file, strings.Join(lines, "\n")); ok {
+		return commands
+	}
+	return document.commands
+}
+
+// importedModule is what a document can use from a module it imports
+type importedModule struct {
+	file      string
+	programs  []definition
+	variables []definition
+}
+
+type server struct {
+	input  *bufio.Reader
+	output io.Writer
+	// open documents by uri
+	documents map[string]*document
+}
+
+// Run serves the language server protocol over stdin and stdout until the
+// client sends exit, or closes stdin
+func Run(stdin io.Reader, stdout io.Writer) error {
+	server := &server{
+		input:     bufio.NewReader(stdin),
+		output:    stdout,
+		documents: make(map[string]*document),
+	}
+
+	for {
+		received, err := readMessage(server.input)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if received.Method == "exit" {
+			return nil
+		}
+		server.handle(received)
+	}
+}
+
+func (server *server) respond(received message, result interface{}) {
+	writeMessage(server.output, response{JSONRPC: "2.0", ID: received.ID, Result: result})
+}
+
+func (server *server) notify(method string, params interface{}) {
+	writeMessage(server.output, notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+func (server *server) handle(received message) {
+	switch received.Method {
+	case "initialize":
+		server.respond(received, map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				// the client sends the whole text of a document on every change
+				"textDocumentSync":      1,
+				"completionProvider":    map[string]interface{}{"triggerCharacters": []string{"$", ":"}},
+				"definitionProvider":    true,
+				"signatureHelpProvider": map[string]interface{}{"triggerCharacters": []string{" "}},
+			},
+			"serverInfo": map[string]interface{}{"name": "morklerork"},
+		})
+	case "shutdown":
+		server.respond(received, nil)
+	case "textDocument/didOpen":
+		var params struct {
+			TextDocument struct {
+				URI  string `json:"uri"`
+				Text string `json:"text"`
+			} `json:"textDocument"`
+		}
+		json.Unmarshal(received.Params, &params)
+		server.update(params.TextDocument.URI, params.TextDocument.Text)
+	case "textDocument/didChange":
+		var params struct {
+			TextDocument struct {
+				URI string `json:"uri"`
+			} `json:"textDocument"`
+			ContentChanges []struct {
+				Text string `json:"text"`
+			} `json:"contentChanges"`
+		}
+		json.Unmarshal(received.Params, &params)
+		if len(params.ContentChanges) > 0 {
+			server.update(params.TextDocument.URI, params.ContentChanges[len(params.ContentChanges)-1].Text)
+		}
+	case "textDocument/didClose":
+		var params struct {
+			TextDocument struct {
+				URI string `json:"uri"`
+			} `json:"textDocument"`
+		}
+		json.Unmarshal(received.Params, &params)
+		delete(server.documents, params.TextDocument.URI)
+		server.notify("textDocument/publishDiagnostics", map[string]interface{}{"uri": params.TextDocument.URI, "diagnostics": []diagnostic{}})
+	case "textDocument/completion":
+		server.complete(received)
+	case "textDocument/definition":
+		server.findDefinition(received)
+	case "textDocument/signatureHelp":
+		server.signatureHelp(received)
+	default:
+		// notifications the server does not use are ignored, requests have to be answered
+		if len(received.ID) > 0 {
+			writeMessage(server.output, response{JSONRPC: "2.0", ID: received.ID, Error: &responseError{Code: methodNotFound, Message: "morklerork does not support " + received.Method}})
+		}
+	}
+}
+
+func uriToFile(uri string) string {
+	parsed, err := url.Parse(uri)
+	if err != nil || parsed.Scheme != "file" {
+		return uri
+	}
+	return filepath.FromSlash(parsed.Path)
+}
+
+func fileToURI(file string) string {
+	absolute, err := filepath.Abs(file)
+	if err != nil {
+		absolute = file
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(absolute)}).String()
+}
+
+// update takes the new text of a document, and publishes its diagnostics
+func (server *server) update(uri string, text string) {
+	current, ok := server.documents[uri]
+	if !ok {
+		current = &document{uri: uri, file: uriToFile(uri)}
+		server.documents[uri] = current
+	}
+	current.text = text
+	if commands, ok := parse(current.file, text); ok {
+		current.commands = commands
+	}
+	server.notify("textDocument/publishDiagnostics", map[string]interface{}{"uri": uri, "diagnostics": current.diagnostics()})
+}
+
+// diagnostics are the errors from lexing the document or, once it lexes, from parsing it.
+// The parser is not run on a document that does not lex, the lines left out
+// would make errors of their own
+func (document *document) diagnostics() []diagnostic {
+	fileSymbols, err := lexer.Lex(document.file, document.text)
+	if err == nil {
+		_, _, err = parser.ParseBlock(fileSymbols, 0)
+	}
+	if err == nil {
+		return []diagnostic{}
+	}
+
+	errs := []error{err}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs = joined.Unwrap()
+	}
+	diagnostics := make([]diagnostic, 0, len(errs))
+	for _, err := range errs {
+		// an error without a position is shown at the start of the file
+		pos := symbols.Position{File: document.file, Line: 1, Column: 1}
+		message := err.Error()
+		var lexError *lexer.LexError
+		var parseError *parser.ParseError
+		if errors.As(err, &lexError) {
+			pos, message = lexError.Pos, lexError.Message
+		} else if errors.As(err, &parseError) {
+			pos, message = parseError.Pos, parseError.Message
+		}
+		word, _ := wordAt(document.line(pos.Line-1), pos.Column-1)
+		if word == "" {
+			word = " "
+		}
+		diagnostics = append(diagnostics, diagnostic{Range: nameRange(pos, word), Severity: severityError, Source: "morklerork", Message: message})
+	}
+	return diagnostics
+}
+
+// imports finds the modules a document's commands import, the same way the loader does
+func (server *server) imports(document *document, commands []ast.Command) []importedModule {
+	modules := make([]importedModule, 0)
+	for _, command := range commands {
+		importCommand, ok := command.(ast.Import)
+		if !ok {
+			continue
+		}
+
+		var file, text string
+		if libFile, isStdlib := stdlib.Lookup(importCommand.Path); isStdlib {
+			file, text = libFile.Name, libFile.Content
+		} else {
+			file = filepath.Join(filepath.Dir(document.file), importCommand.Path)
+			if open, ok := server.documents[fileToURI(file)]; ok {
+				text = open.text
+			} else if content, err := os.ReadFile(file); err == nil {
+				text = string(content)
+			} else {
+				continue
+			}
+		}
+		moduleCommands, ok := parse(file, text)
+		if !ok {
+			continue
+		}
+
+		// only the module's public names, like $heap$new, can be used by the importer
+		isPublic := func(definition definition) bool {
+			return strings.HasPrefix(definition.name[1:], strings.TrimSuffix(filepath.Base(file), ".mr")+"$")
+		}
+		module := importedModule{file: file}
+		for _, program := range programsIn(moduleCommands) {
+			if isPublic(program) {
+				module.programs = append(module.programs, program)
+			}
+		}
+		for _, variable := range topLevelVariables(moduleCommands) {
+			if isPublic(variable) {
+				module.variables = append(module.variables, variable)
+			}
+		}
+		modules = append(modules, module)
+	}
+	return modules
+}
+
+// programs lists the programs a document defines, then those it imports,
+// then those built in to the executor
+func (server *server) programs(document *document, commands []ast.Command) []definition {
+	programs := programsIn(commands)
+	for _, module := range server.imports(document, commands) {
+		programs = append(programs, module.programs...)
+	}
+	for _, builtin := range executor.BuiltinPrograms() {
+		programs = append(programs, definition{name: builtin.Name, parameters: builtin.Parameters})
+	}
+	return programs
+}
+
+func (server *server) readPosition(received message) (*document, position, bool) {
+	var params textDocumentPosition
+	json.Unmarshal(received.Params, &params)
+	document, ok := server.documents[params.TextDocument.URI]
+	return document, params.Position, ok
+}
+
+// complete lists the programs, or the variables in scope, that could finish the symbol being written
+func (server *server) complete(received message) {
+	document, cursor, ok := server.readPosition(received)
+	if !ok {
+		server.respond(received, []completionItem{})
+		return
+	}
+	line := document.line(cursor.Line)
+	// only what is before the cursor is being completed
+	word, start := wordAt(before(line, cursor.Character), cursor.Character)
+	replaced := textRange{Start: position{Line: cursor.Line, Character: start}, End: cursor}
+	commands := document.commandsWithout(cursor.Line)
+
+	items := make([]completionItem, 0)
+	if !strings.HasPrefix(word, ":") {
+		for _, program := range server.programs(document, commands) {
+			if strings.HasPrefix(program.name, word) {
+				items = append(items, completionItem{Label: program.name, Kind: functionKind, Detail: "program " + program.signature(), TextEdit: textEdit{Range: replaced, NewText: program.name}})
+			}
+		}
+	}
+	if !strings.HasPrefix(word, "$") {
+		variables, isInProgram := variablesAt(commands, cursor.Line+1, indentOf(line))
+		if !isInProgram {
+			for _, module := range server.imports(document, commands) {
+				variables = append(variables, module.variables...)
+			}
+		}
+		seen := make(map[string]bool)
+		for _, variable := range variables {
+			if strings.HasPrefix(variable.name, word) && !seen[variable.name] {
+				seen[variable.name] = true
+				items = append(items, completionItem{Label: variable.name, Kind: variableKind, TextEdit: textEdit{Range: replaced, NewText: variable.name}})
+			}
+		}
+	}
+	server.respond(received, items)
+}
+
+// findDefinition finds the `program` command or `new` declaration of the name at the cursor
+func (server *server) findDefinition(received message) {
+	document, cursor, ok := server.readPosition(received)
+	if !ok {
+		server.respond(received, nil)
+		return
+	}
+	line := document.line(cursor.Line)
+	name, _ := wordAt(line, cursor.Character)
+	commands := document.commandsWithout(-1)
+
+	found := func(file string, definition definition) {
+		if _, isStdlib := stdlib.FileNamed(file); isStdlib {
+			// the stdlib is embedded, there is no file for the editor to open
+			server.respond(received, nil)
+			return
+		}
+		server.respond(received, location{URI: fileToURI(file), Range: nameRange(definition.pos, definition.name)})
+	}
+
+	if strings.HasPrefix(name, "$") {
+		for _, program := range programsIn(commands) {
+			if program.name == name {
+				found(document.file, program)
+				return
+			}
+		}
+		for _, module := range server.imports(document, commands) {
+			for _, program := range module.programs {
+				if program.name == name {
+					found(module.file, program)
+					return
+				}
+			}
+		}
+	} else if strings.HasPrefix(name, ":") {
+		if declared, ok := declaredOn(commands, cursor.Line+1, name); ok {
+			found(document.file, declared)
+			return
+		}
+		variables, isInProgram := variablesAt(commands, cursor.Line+1, indentOf(line))
+		// a name declared again in an inner block hides the outer one
+		for i := len(variables) - 1; i >= 0; i-- {
+			if variables[i].name == name {
+				found(document.file, variables[i])
+				return
+			}
+		}
+		if !isInProgram {
+			for _, module := range server.imports(document, commands) {
+				for _, variable := range module.variables {
+					if variable.name == name {
+						found(module.file, variable)
+						return
+					}
+				}
+			}
+		}
+	}
+	server.respond(received, nil)
+}
+
+// signatureHelp shows the parameters of the program being called on the cursor's line
+func (server *server) signatureHelp(received message) {
+	document, cursor, ok := server.readPosition(received)
+	if !ok {
+		server.respond(received, nil)
+		return
+	}
+	name, argument, ok := argumentIndex(before(document.line(cursor.Line), cursor.Character))
+	if !ok {
+		server.respond(received, nil)
+		return
+	}
+
+	for _, program := range server.programs(document, document.commandsWithout(cursor.Line)) {
+		if program.name != name {
+			continue
+		}
+		parameters := make([]parameterInformation, 0, len(program.parameters))
+		for _, parameter := range program.parameters {
+			parameters = append(parameters, parameterInformation{Label: parameter})
+		}
+		server.respond(received, map[string]interface{}{
+			"signatures":      []signatureInformation{{Label: program.signature(), Parameters: parameters}},
+			"activeSignature": 0,
+			"activeParameter": argument,
+		})
+		return
+	}
+	server.respond(received, nil)
+}
@@ -0,0 +1,222 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// client plays the part of an editor, sending messages to a server and reading what it sends back
+type client struct {
+	t        *testing.T
+	requests io.Writer
+	messages chan map[string]interface{}
+	id       int
+	// notifications read while waiting for a response, in the order they came
+	notifications []map[string]interface{}
+}
+
+func newClient(t *testing.T) *client {
+	clientToServer, requests := io.Pipe()
+	serverToClient, responses := io.Pipe()
+	client := &client{t: t, requests: requests, messages: make(chan map[string]interface{}, 100)}
+
+	done := make(chan error)
+	go func() {
+		done <- Run(clientToServer, responses)
+		responses.Close()
+	}()
+	go func() {
+		defer close(client.messages)
+		input := bufio.NewReader(serverToClient)
+		for {
+			received, err := readSent(input)
+			if err != nil {
+				return
+			}
+			client.messages <- received
+		}
+	}()
+	t.Cleanup(func() {
+		client.send(map[string]interface{}{"jsonrpc": "2.0", "method": "exit"})
+		requests.Close()
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+	})
+	return client
+}
+
+// readSent reads the next response or notification the way readMessage reads a request
+func readSent(input *bufio.Reader) (map[string]interface{}, error) {
+	headers, err := textproto.NewReader(input).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	length, err := strconv.Atoi(headers.Get("Content-Length"))
+	if err != nil {
+		return nil, err
+	}
+	content := make([]byte, length)
+	if _, err := io.ReadFull(input, content); err != nil {
+		return nil, err
+	}
+	var received map[string]interface{}
+	err = json.Unmarshal(content, &received)
+	return received, err
+}
+
+func (client *client) send(content map[string]interface{}) {
+	client.t.Helper()
+	if err := writeMessage(client.requests, content); err != nil {
+		client.t.Fatal(err)
+	}
+}
+
+// next is the next message from the server, failing the test if it takes too long
+func (client *client) next() map[string]interface{} {
+	client.t.Helper()
+	select {
+	case received, ok := <-client.messages:
+		if !ok {
+			client.t.Fatal("the server stopped sending messages")
+		}
+		return received
+	case <-time.After(5 * time.Second):
+		client.t.Fatal("timed out waiting for the server")
+	}
+	return nil
+}
+
+// request sends a request and returns the result of its response, as JSON
+// read back into go values
+func (client *client) request(method string, params interface{}) interface{} {
+	client.t.Helper()
+	client.id++
+	client.send(map[string]interface{}{"jsonrpc": "2.0", "id": client.id, "method": method, "params": params})
+	for {
+		received := client.next()
+		if _, isNotification := received["method"]; isNotification {
+			client.notifications = append(client.notifications, received)
+			continue
+		}
+		if received["id"] != float64(client.id) || received["error"] != nil {
+			client.t.Fatalf("expected the result of %s, got %v", method, received)
+		}
+		return received["result"]
+	}
+}
+
+// notify sends a notification, which has no response
+func (client *client) notify(method string, params interface{}) {
+	client.t.Helper()
+	client.send(map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params})
+}
+
+// waitFor returns the params of the next notification with a method, skipping the ones before it
+func (client *client) waitFor(method string) map[string]interface{} {
+	client.t.Helper()
+	for {
+		var received map[string]interface{}
+		if len(client.notifications) > 0 {
+			received, client.notifications = client.notifications[0], client.notifications[1:]
+		} else {
+			received = client.next()
+		}
+		if received["method"] == method {
+			return received["params"].(map[string]interface{})
+		}
+	}
+}
+
+// textDocument is the params naming a document, with a position in it if line is not -1
+func textDocument(uri string, line int, character int) map[string]interface{} {
+	params := map[string]interface{}{"textDocument": map[string]interface{}{"uri": uri}}
+	if line >= 0 {
+		params["position"] = map[string]interface{}{"line": line, "character": character}
+	}
+	return params
+}
+
+// the messages read back are JSON objects, so a field is read through maps
+func field(value interface{}, keys ...string) interface{} {
+	for _, key := range keys {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[key]
+	}
+	return value
+}
+
+func TestLanguageServer(t *testing.T) {
+	directory := t.TempDir()
+	client := newClient(t)
+
+	capabilities := field(client.request("initialize", map[string]interface{}{"rootUri": fileToURI(directory)}), "capabilities")
+	if field(capabilities, "definitionProvider") != true || field(capabilities, "completionProvider") == nil || field(capabilities, "signatureHelpProvider") == nil {
+		t.Errorf("expected completion, definition and signature help, got %v", capabilities)
+	}
+	client.notify("initialized", map[string]interface{}{})
+
+	broken := fileToURI(filepath.Join(directory, "broken.mr"))
+	client.notify("textDocument/didOpen", map[string]interface{}{"textDocument": map[string]interface{}{"uri": broken, "languageId": "morklerork", "version": 1, "text": "log 1\nlog  2\n"}})
+	published := client.waitFor("textDocument/publishDiagnostics")
+	diagnostics, _ := published["diagnostics"].([]interface{})
+	if published["uri"] != broken || len(diagnostics) != 1 {
+		t.Fatalf("expected one diagnostic for %s, got %v", broken, published)
+	}
+	start := field(diagnostics[0], "range", "start")
+	if field(start, "line") != 1.0 || field(start, "character") != 4.0 || field(diagnostics[0], "message") != "Empty symbol, symbols should be separated by exactly one space" {
+		t.Errorf("expected the empty symbol on line 2, got %v", diagnostics[0])
+	}
+
+	file := filepath.Join(directory, "program.mr")
+	text := `import 'heap'
+
+program $add :left :right
+    return :left + :right
+
+new :sum 0
+call :sum $add 1 2
+call $heap$
+`
+	if err := os.WriteFile(file, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+	uri := fileToURI(file)
+	client.notify("textDocument/didOpen", map[string]interface{}{"textDocument": map[string]interface{}{"uri": uri, "languageId": "morklerork", "version": 1, "text": text}})
+	client.waitFor("textDocument/publishDiagnostics")
+
+	completions := map[string]bool{}
+	for _, item := range client.request("textDocument/completion", textDocument(uri, 7, 11)).([]interface{}) {
+		completions[field(item, "label").(string)] = true
+	}
+	if !completions["$heap$new"] || !completions["$heap$init"] || completions["$add"] {
+		t.Errorf("expected the $heap$ programs from the stdlib, got %v", completions)
+	}
+
+	definition := client.request("textDocument/definition", textDocument(uri, 6, 12))
+	if field(definition, "uri") != uri || field(definition, "range", "start", "line") != 2.0 || field(definition, "range", "start", "character") != 8.0 {
+		t.Errorf("expected $add to be defined on line 3, got %v", definition)
+	}
+
+	help := client.request("textDocument/signatureHelp", textDocument(uri, 6, 17))
+	signatures, _ := field(help, "signatures").([]interface{})
+	if len(signatures) != 1 || field(help, "activeParameter") != 1.0 {
+		t.Fatalf("expected the signature of $add on its second argument, got %v", help)
+	}
+	parameters := field(signatures[0], "parameters").([]interface{})
+	if len(parameters) != 2 || field(parameters[0], "label") != ":left" || field(parameters[1], "label") != ":right" {
+		t.Errorf("expected the parameters :left and :right, got %v", parameters)
+	}
+
+	client.request("shutdown", nil)
+}
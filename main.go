@@ -1,15 +1,160 @@
 package main
 
 import (
+	"errors"
+	"flag"
+	"fmt"
+	"morklerork/dap"
+	"morklerork/debugger"
 	"morklerork/executor"
-	"morklerork/lexer"
+	"morklerork/format"
+	"morklerork/golden"
 	"morklerork/loader"
-	"morklerork/parser"
+	"morklerork/lsp"
+	"morklerork/repl"
+	"morklerork/runflags"
+	"morklerork/testrunner"
+	"morklerork/vet"
+	"os"
 )
 
+// exitWithError prints an error from any stage of the interpreter and exits.
+// errors are already prefixed with file:line:column where they have one
+func exitWithError(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
+
+// runProgram runs a file and everything it imports, printing what -cover
+// and -profile recorded to stderr, as the program's output is on stdout
+func runProgram(fileName string, runFlags *runflags.Flags) error {
+	options, err := runFlags.Options()
+	if err != nil {
+		return err
+	}
+	programAst, err := loader.Load(fileName)
+	if err != nil {
+		return err
+	}
+
+	options.RawTerminal = true
+	interpreter := executor.NewInterpreter(os.Stdin, os.Stdout, runFlags.HeapSize, options)
+	err = interpreter.Execute(programAst)
+	return errors.Join(err, runFlags.Report(options, os.Stderr))
+}
+
 func main() {
-	programString := loader.Load()
-	programSymbols := lexer.Lex(programString)
-	programAst, _ := parser.ParseBlock(programSymbols, 0)
-	executor.ExecuteProgram(programAst)
+	runFlags := runflags.New()
+	runFlags.Register(flag.CommandLine)
+	flag.Parse()
+	if _, err := runFlags.Options(); err != nil {
+		exitWithError(err)
+	}
+
+	if flag.NArg() == 2 && flag.Arg(0) == "debug" {
+		options, err := runFlags.Options()
+		if err != nil {
+			exitWithError(err)
+		}
+		err = debugger.Run(flag.Arg(1), os.Stdin, os.Stdout, runFlags.HeapSize, options)
+		err = errors.Join(err, runFlags.Report(options, os.Stderr))
+		if err != nil {
+			exitWithError(err)
+		}
+		return
+	}
+
+	if flag.NArg() == 2 && flag.Arg(0) == "vet" {
+		programAst, err := loader.Load(flag.Arg(1))
+		if err != nil {
+			exitWithError(err)
+		}
+		err = vet.Check(programAst)
+		if err != nil {
+			exitWithError(err)
+		}
+		return
+	}
+
+	if flag.NArg() > 0 && flag.Arg(0) == "fmt" {
+		err := format.Run(flag.Args()[1:], os.Stdout)
+		if err != nil {
+			exitWithError(err)
+		}
+		return
+	}
+
+	if flag.NArg() > 0 && flag.Arg(0) == "test" {
+		err := testrunner.Run(flag.Args()[1:], os.Stdout, runFlags)
+		if err != nil {
+			exitWithError(err)
+		}
+		return
+	}
+
+	if flag.NArg() > 0 && flag.Arg(0) == "check-golden" {
+		err := golden.Run(flag.Args()[1:], os.Stdout, runFlags)
+		if err != nil {
+			exitWithError(err)
+		}
+		return
+	}
+
+	if flag.NArg() > 0 && flag.Arg(0) == "run" {
+		flags := flag.NewFlagSet("run", flag.ContinueOnError)
+		runFlags.Register(flags)
+		if err := flags.Parse(flag.Args()[1:]); err != nil {
+			exitWithError(err)
+		}
+		if flags.NArg() != 1 {
+			exitWithError(errors.New("usage: morklerork run [flags] program.mr"))
+		}
+		if err := runProgram(flags.Arg(0), runFlags); err != nil {
+			exitWithError(err)
+		}
+		return
+	}
+
+	if flag.NArg() != 1 {
+		exitWithError(errors.New("usage: morklerork [-treewalker] [-max-steps n] [-max-depth n] [-timeout d] [-heap n] [-growheap] [-cover] [-coverfile file] [-profile file] <program.mr | run [flags] program.mr | repl | dap | lsp | debug program.mr | vet program.mr | fmt [-w] [-d] program.mr... | test [-run regex] [-v] [flags] [path...] | check-golden [-update] [flags] [path...]>, other files are loaded with import"))
+	}
+
+	if flag.Arg(0) == "dap" {
+		// stdout is the protocol, so what -cover and -profile recorded goes to stderr
+		options, err := runFlags.Options()
+		if err != nil {
+			exitWithError(err)
+		}
+		err = dap.Run(os.Stdin, os.Stdout, runFlags.HeapSize, options)
+		err = errors.Join(err, runFlags.Report(options, os.Stderr))
+		if err != nil {
+			exitWithError(err)
+		}
+		return
+	}
+
+	if flag.Arg(0) == "lsp" {
+		err := lsp.Run(os.Stdin, os.Stdout)
+		if err != nil {
+			exitWithError(err)
+		}
+		return
+	}
+
+	if flag.Arg(0) == "repl" {
+		options, err := runFlags.Options()
+		if err != nil {
+			exitWithError(err)
+		}
+		err = repl.Run(os.Stdin, os.Stdout, runFlags.HeapSize, options)
+		err = errors.Join(err, runFlags.Report(options, os.Stderr))
+		if err != nil {
+			exitWithError(err)
+		}
+		return
+	}
+
+	if err := runProgram(flag.Arg(0), runFlags); err != nil {
+		exitWithError(err)
+	}
 }
@@ -0,0 +1,28 @@
+package parser
+
+import "morklerork/symbols"
+
+// ParseErrorKind is what went wrong in a ParseError
+type ParseErrorKind int
+
+const (
+	ExpressionError ParseErrorKind = iota
+	CommandError
+	IndentationError
+	MissingBlockError
+)
+
+// ParseError is returned by ParseBlock for any command that could not be parsed
+type ParseError struct {
+	Pos     symbols.Position
+	Kind    ParseErrorKind
+	Message string
+}
+
+func (err *ParseError) Error() string {
+	return err.Pos.String() + ": " + err.Message
+}
+
+func newParseError(pos symbols.Position, kind ParseErrorKind, message string) *ParseError {
+	return &ParseError{Pos: pos, Kind: kind, Message: message}
+}
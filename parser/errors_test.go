@@ -0,0 +1,37 @@
+package parser
+
+import (
+	"errors"
+	"morklerork/lexer"
+	"testing"
+)
+
+func TestParseErrorKind(t *testing.T) {
+	tests := []struct {
+		name    string
+		program string
+		kind    ParseErrorKind
+		message string
+	}{
+		{"an unclosed bracket", "log ( 1 + 2\n", ExpressionError, "test.mr:1:5: this ( is never closed"},
+		{"a call without a program", "call\n", CommandError, "test.mr:1:1: call needs a program name"},
+		{"an unexpected indent", "log 1\n    log 2\n", IndentationError, "test.mr:2:1: The indentation unexpectedly increased"},
+		{"a missing block", "if ?true\nlog 1\n", MissingBlockError, "test.mr:1:1: The next command after a block command was not indented"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			program, err := lexer.Lex("test.mr", test.program)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, _, err = ParseBlock(program, 0)
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) || parseErr.Kind != test.kind {
+				t.Fatalf("expected a ParseError of kind %d, got %v", test.kind, err)
+			}
+			if err.Error() != test.message {
+				t.Errorf("expected %q, got %q", test.message, err.Error())
+			}
+		})
+	}
+}
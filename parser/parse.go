@@ -3,251 +3,435 @@ package parser
 import (
 	"errors"
 	"fmt"
-	"log"
 	"morklerork/ast"
 	"morklerork/symbols"
 )
 
-func splitByLowestPrecedence(expressionSymbols []symbols.Symbol) ([]symbols.Symbol, symbols.BinaryOperator, []symbols.Symbol, error) {
-	if len(expressionSymbols) < 3 {
-		return nil, symbols.BinaryOperator{}, nil, errors.New("not enough symbols in expression slice to split: " + fmt.Sprint(expressionSymbols))
-	}
-
-	index := -1
-	for i, symbol := range expressionSymbols {
-		switch symbol.(type) {
-		case symbols.BinaryOperator:
-			if index == -1 {
-				index = i
-			} else {
-				// we can directly compare the enum values since they are ints under the hood, and are in the right order
-				// also, if the precedence is equal, take the _later_ operator so that _earlier_ operators execute first
-				if symbol.(symbols.BinaryOperator).BinaryOperatorType <= expressionSymbols[index].(symbols.BinaryOperator).BinaryOperatorType {
-					index = i
-				}
-			}
-		}
-	}
-
-	return expressionSymbols[:index], expressionSymbols[index].(symbols.BinaryOperator), expressionSymbols[index+1:], nil
-}
-
 func parseSingleSymbolExpression(expressionSymbol symbols.Symbol) (ast.Expression, error) {
 	switch expressionSymbol := expressionSymbol.(type) {
 	case symbols.StringLiteral:
-		return ast.StringLiteral{Value: expressionSymbol.Value}, nil
+		return ast.StringLiteral{Value: expressionSymbol.Value, Pos: expressionSymbol.Pos}, nil
 	case symbols.IntLiteral:
-		return ast.IntLiteral{Value: expressionSymbol.Value}, nil
+		return ast.IntLiteral{Value: expressionSymbol.Value, Pos: expressionSymbol.Pos}, nil
 	case symbols.BooleanLiteral:
-		return ast.BooleanLiteral{Value: expressionSymbol.Value}, nil
+		return ast.BooleanLiteral{Value: expressionSymbol.Value, Pos: expressionSymbol.Pos}, nil
 	case symbols.VariableName:
-		return ast.VariableName{Name: expressionSymbol.Name}, nil
-	case symbols.HeapAccess:
-		expr, err := parseSingleSymbolExpression(expressionSymbol.IndexExpressionSymbol)
-		if err != nil {
-			return expr, err
-		}
-		return ast.HeapAccess{IndexExpression: expr}, nil
+		return ast.VariableName{Name: expressionSymbol.Name, Pos: expressionSymbol.Pos}, nil
 	}
-	fmt.Println(expressionSymbol)
-	return nil, errors.New("the value symbol was not a String or an Int")
+	return nil, newParseError(symbols.PositionOf(expressionSymbol), ExpressionError, "the value symbol was not a String or an Int")
 }
 
-func parseExpression(expressionSymbols []symbols.Symbol) (ast.Expression, error) {
+// expressionParser walks the symbols of one expression, building the ast
+// by precedence climbing
+type expressionParser struct {
+	expressionSymbols []symbols.Symbol
+	index             int
+	// endsAtOperand ends the expression at a symbol that is not an operator,
+	// instead of that being an error, so a command can take another operand after it
+	endsAtOperand bool
+}
 
-	if len(expressionSymbols) == 0 {
-		return nil, errors.New("tried to parse and empty expression")
-	}
+func (parser *expressionParser) isDone() bool {
+	return parser.index >= len(parser.expressionSymbols)
+}
 
-	if len(expressionSymbols) == 1 {
-		return parseSingleSymbolExpression(expressionSymbols[0])
-	}
+func (parser *expressionParser) next() symbols.Symbol {
+	symbol := parser.expressionSymbols[parser.index]
+	parser.index++
+	return symbol
+}
 
-	// counter intuitively, the first thing we split on will be executed last
-	// So split on the _lowest_ precedence
-	lhs, operator, rhs, err := splitByLowestPrecedence(expressionSymbols)
+// closingBracket gives the text of a ) or ] symbol, or "" for any other symbol
+func closingBracket(symbol symbols.Symbol) string {
+	switch symbol.(type) {
+	case symbols.CloseParenthesis:
+		return ")"
+	case symbols.CloseHeapAccess:
+		return "]"
+	}
+	return ""
+}
 
+// parseBracketed parses the expression after an opening bracket, up to and including its closer
+func (parser *expressionParser) parseBracketed(opener string, closer string, pos symbols.Position) (ast.Expression, error) {
+	expr, err := parser.parseBinaryOperators(0, pos)
 	if err != nil {
 		return nil, err
 	}
+	if parser.isDone() {
+		return nil, newParseError(pos, ExpressionError, "this "+opener+" is never closed")
+	}
+	if closingBracket(parser.next()) != closer {
+		return nil, newParseError(symbols.PositionOf(parser.expressionSymbols[parser.index-1]), ExpressionError, "expected an operator or "+closer)
+	}
+	return expr, nil
+}
+
+// parseOperand parses a single symbol, a whole expression in parentheses,
+// or a HeapAccess with the expression for its address in brackets
+func (parser *expressionParser) parseOperand(pos symbols.Position) (ast.Expression, error) {
+	if parser.isDone() {
+		return nil, newParseError(pos, ExpressionError, "expected a value after this")
+	}
 
-	parsedLhs, err := parseExpression(lhs)
+	symbol := parser.next()
+	switch symbol := symbol.(type) {
+	case symbols.OpenParenthesis:
+		return parser.parseBracketed("(", ")", symbol.Pos)
+	case symbols.OpenHeapAccess:
+		expr, err := parser.parseBracketed("[", "]", symbol.Pos)
+		if err != nil {
+			return nil, err
+		}
+		return ast.HeapAccess{IndexExpression: expr, Pos: symbol.Pos}, nil
+	case symbols.CloseParenthesis, symbols.CloseHeapAccess:
+		return nil, newParseError(symbols.PositionOf(symbol), ExpressionError, "expected a value before this "+closingBracket(symbol))
+	}
+	return parseSingleSymbolExpression(symbol)
+}
 
+// parseBinaryOperators parses operands joined by operators with a precedence of at least minPrecedence
+// Parsing the right hand side with a higher minimum is what makes same tier operators left associative
+func (parser *expressionParser) parseBinaryOperators(minPrecedence int, pos symbols.Position) (ast.Expression, error) {
+	lhs, err := parser.parseOperand(pos)
 	if err != nil {
 		return nil, err
 	}
 
-	parsedRhs, err := parseExpression(rhs)
+	for !parser.isDone() {
+		symbol := parser.expressionSymbols[parser.index]
+		if closingBracket(symbol) != "" {
+			// leave it for the parseBracketed that opened it
+			return lhs, nil
+		}
+		operator, ok := symbol.(symbols.BinaryOperator)
+		if !ok && parser.endsAtOperand {
+			return lhs, nil
+		}
+		if !ok {
+			return nil, newParseError(symbols.PositionOf(symbol), ExpressionError, "expected an operator between the symbols in this expression")
+		}
+		precedence := symbols.BinaryOperatorPrecedence[operator.BinaryOperatorType]
+		if precedence < minPrecedence {
+			return lhs, nil
+		}
+		parser.index++
+
+		rhs, err := parser.parseBinaryOperators(precedence+1, operator.Pos)
+		if err != nil {
+			return nil, err
+		}
 
-	if err != nil {
-		return nil, err
+		lhs = ast.BinaryOperator{
+			Lhs:                lhs,
+			Rhs:                rhs,
+			BinaryOperatorType: operator.BinaryOperatorType,
+			Pos:                operator.Pos,
+		}
 	}
 
-	return ast.BinaryOperator{
-		Lhs:                parsedLhs,
-		Rhs:                parsedRhs,
-		BinaryOperatorType: operator.BinaryOperatorType,
-	}, nil
+	return lhs, nil
 }
 
-func parseLog(logSymbols []symbols.Symbol, indent int) ast.Log {
-	expr, err := parseExpression(logSymbols)
+// ParseExpression parses the symbols of one whole expression
+func ParseExpression(expressionSymbols []symbols.Symbol, pos symbols.Position) (ast.Expression, error) {
+
+	if len(expressionSymbols) == 0 {
+		return nil, newParseError(pos, ExpressionError, "tried to parse and empty expression")
+	}
+
+	parser := &expressionParser{expressionSymbols: expressionSymbols}
+	expr, err := parser.parseBinaryOperators(0, pos)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
-	return ast.Log{Expr: expr, Indent: indent}
-}
 
-func parseRead(readSymbols []symbols.Symbol, indent int) ast.Read {
-	var target ast.Expression
+	if !parser.isDone() {
+		// the only way to stop early is an unmatched ) or ]
+		unmatched := parser.expressionSymbols[parser.index]
+		return nil, newParseError(symbols.PositionOf(unmatched), ExpressionError, "this "+closingBracket(unmatched)+" was never opened")
+	}
 
-	switch targetSymbol := readSymbols[0].(type) {
+	return expr, nil
+}
+
+// parseTarget parses the Variable or HeapAccess a command writes its result into,
+// returning the symbols after the target
+func parseTarget(targetSymbols []symbols.Symbol, commandName string, pos symbols.Position) (ast.Expression, []symbols.Symbol, error) {
+	if len(targetSymbols) == 0 {
+		return nil, nil, newParseError(pos, CommandError, commandName+" needs a variable or heap access to write to")
+	}
+	switch targetSymbol := targetSymbols[0].(type) {
 	case symbols.VariableName:
-		target = ast.VariableName{Name: targetSymbol.Name}
-		break
-	case symbols.HeapAccess:
-		// Since HeapAccess can have more HeapAccesses inside it needs to be fully parsed
-		parsedHeapAccess, err := parseSingleSymbolExpression(targetSymbol)
+		return ast.VariableName{Name: targetSymbol.Name, Pos: targetSymbol.Pos}, targetSymbols[1:], nil
+	case symbols.OpenHeapAccess:
+		// the address can be any expression, so parse up to the matching ]
+		parser := &expressionParser{expressionSymbols: targetSymbols}
+		target, err := parser.parseOperand(pos)
 		if err != nil {
-			log.Fatal(err)
+			return nil, nil, err
 		}
-		target = parsedHeapAccess
-		break
-	default:
-		log.Fatal("The first symbol in a read must be a variable or heap access")
+		return target, targetSymbols[parser.index:], nil
 	}
+	return nil, nil, newParseError(symbols.PositionOf(targetSymbols[0]), CommandError, "The first symbol in "+commandName+" must be a variable or heap access")
+}
+
+func parseLog(logSymbols []symbols.Symbol, indent int, pos symbols.Position) (ast.Log, error) {
+	expr, err := ParseExpression(logSymbols, pos)
+	if err != nil {
+		return ast.Log{}, err
+	}
+	return ast.Log{Expr: expr, Indent: indent, Pos: pos}, nil
+}
 
-	if len(readSymbols) != 1 {
-		log.Fatal("Read should only be given 2 symbol")
+func parseRead(readSymbols []symbols.Symbol, indent int, pos symbols.Position) (ast.Read, error) {
+	target, rest, err := parseTarget(readSymbols, "a read", pos)
+	if err != nil {
+		return ast.Read{}, err
+	}
+	if len(rest) != 0 {
+		return ast.Read{}, newParseError(symbols.PositionOf(rest[0]), CommandError, "Read should only be given a variable or heap access")
 	}
 
-	return ast.Read{Target: target, Indent: indent}
+	return ast.Read{Target: target, Indent: indent, Pos: pos}, nil
 }
 
-func parseAssign(assignSymbols []symbols.Symbol, indent int) ast.Assign {
-	var target ast.Expression
+func parseAssign(assignSymbols []symbols.Symbol, indent int, pos symbols.Position) (ast.Assign, error) {
+	if len(assignSymbols) == 0 {
+		return ast.Assign{}, newParseError(pos, CommandError, "An assignment needs a target and an expression")
+	}
 
-	switch targetSymbol := assignSymbols[0].(type) {
-	case symbols.VariableName:
-		target = ast.VariableName{Name: targetSymbol.Name}
-		break
-	case symbols.HeapAccess:
-		// Since HeapAccess can have more HeapAccesses inside it needs to be fully parsed
-		parsedHeapAccess, err := parseSingleSymbolExpression(targetSymbol)
-		if err != nil {
-			log.Fatal(err)
-		}
-		target = parsedHeapAccess
-		break
-	default:
-		log.Fatal("The first symbol in an assignment must be a variable or heap access")
+	target, rest, err := parseTarget(assignSymbols, "an assignment", pos)
+	if err != nil {
+		return ast.Assign{}, err
 	}
 
-	expr, err := parseExpression(assignSymbols[1:])
+	expr, err := ParseExpression(rest, pos)
 	if err != nil {
-		log.Fatal(err)
+		return ast.Assign{}, err
 	}
 
-	return ast.Assign{Target: target, Expr: expr, Indent: indent}
+	return ast.Assign{Target: target, Expr: expr, Indent: indent, Pos: pos}, nil
 }
 
-func parseNew(newSymbols []symbols.Symbol, indent int) ast.New {
-	variableName := newSymbols[0]
-	expr, err := parseExpression(newSymbols[1:])
+func parseNew(newSymbols []symbols.Symbol, indent int, pos symbols.Position) (ast.New, error) {
+	if len(newSymbols) == 0 {
+		return ast.New{}, newParseError(pos, CommandError, "new needs a variable name and an expression")
+	}
+	variableName, ok := newSymbols[0].(symbols.VariableName)
+	if !ok {
+		return ast.New{}, newParseError(symbols.PositionOf(newSymbols[0]), CommandError, "The first symbol in a new must be a variable")
+	}
+	expr, err := ParseExpression(newSymbols[1:], pos)
 	if err != nil {
-		log.Fatal(err)
+		return ast.New{}, err
 	}
-	return ast.New{VariableName: variableName.(symbols.VariableName).Name, Expr: expr, Indent: indent}
+	return ast.New{VariableName: variableName.Name, Expr: expr, Indent: indent, Pos: pos}, nil
 }
 
-func parseIf(IfSymbols []symbols.Symbol, indent int) ast.If {
-	expr, err := parseExpression(IfSymbols)
+func parseIf(IfSymbols []symbols.Symbol, indent int, pos symbols.Position) (ast.If, error) {
+	expr, err := ParseExpression(IfSymbols, pos)
 	if err != nil {
-		log.Fatal(err)
+		return ast.If{}, err
 	}
-	return ast.If{Cond: expr, Indent: indent}
+	return ast.If{Cond: expr, Indent: indent, Pos: pos}, nil
 }
 
-func parseWhile(WhileSymbols []symbols.Symbol, indent int) ast.While {
-	expr, err := parseExpression(WhileSymbols)
+func parseElseIf(ElseIfSymbols []symbols.Symbol, indent int, pos symbols.Position) (ast.ElseIf, error) {
+	expr, err := ParseExpression(ElseIfSymbols, pos)
 	if err != nil {
-		log.Fatal(err)
+		return ast.ElseIf{}, err
+	}
+	return ast.ElseIf{Cond: expr, Indent: indent, Pos: pos}, nil
+}
+
+func parseElse(ElseSymbols []symbols.Symbol, indent int, pos symbols.Position) (ast.Else, error) {
+	if len(ElseSymbols) != 0 {
+		return ast.Else{}, newParseError(symbols.PositionOf(ElseSymbols[0]), CommandError, "else does not take an expression, did you mean elif?")
 	}
-	return ast.While{Cond: expr, Indent: indent}
+	return ast.Else{Indent: indent, Pos: pos}, nil
 }
 
-func parseProgram(ProgramSymbols []symbols.Symbol, indent int) ast.Program {
-	name := ast.ProgramName{Name: ProgramSymbols[0].(symbols.ProgramName).Name}
+func parseWhile(WhileSymbols []symbols.Symbol, indent int, pos symbols.Position) (ast.While, error) {
+	expr, err := ParseExpression(WhileSymbols, pos)
+	if err != nil {
+		return ast.While{}, err
+	}
+	return ast.While{Cond: expr, Indent: indent, Pos: pos}, nil
+}
+
+func parseProgram(ProgramSymbols []symbols.Symbol, indent int, pos symbols.Position) (ast.Program, error) {
+	if len(ProgramSymbols) == 0 {
+		return ast.Program{}, newParseError(pos, CommandError, "program needs a program name")
+	}
+	nameSymbol, ok := ProgramSymbols[0].(symbols.ProgramName)
+	if !ok {
+		return ast.Program{}, newParseError(symbols.PositionOf(ProgramSymbols[0]), CommandError, "The first symbol in a program must be a program name")
+	}
+	name := ast.ProgramName{Name: nameSymbol.Name, Pos: nameSymbol.Pos}
 	parameterSymbols := ProgramSymbols[1:]
 	variables := make([]ast.VariableName, 0)
-	for i, _ := range parameterSymbols {
-		expr, err := parseSingleSymbolExpression(parameterSymbols[i])
-		if err != nil {
-			log.Fatal(err)
+	for _, parameterSymbol := range parameterSymbols {
+		variable, ok := parameterSymbol.(symbols.VariableName)
+		if !ok {
+			return ast.Program{}, newParseError(symbols.PositionOf(parameterSymbol), CommandError, "program parameters must be variables")
 		}
-		variables = append(variables, expr.(ast.VariableName))
+		variables = append(variables, ast.VariableName{Name: variable.Name, Pos: variable.Pos})
 	}
-	return ast.Program{Name: name, Parameters: variables, Indent: indent}
+	return ast.Program{Name: name, Parameters: variables, Indent: indent, Pos: pos}, nil
 }
 
-func parseCall(CallSymbols []symbols.Symbol, indent int) ast.Call {
+func parseCall(CallSymbols []symbols.Symbol, indent int, pos symbols.Position) (ast.Call, error) {
 	callSymbols := CallSymbols[:]
+	if len(callSymbols) == 0 {
+		return ast.Call{}, newParseError(pos, CommandError, "call needs a program name")
+	}
 	returnTargetName, hasReturnTarget := callSymbols[0].(symbols.VariableName)
 	if hasReturnTarget { // if a return target was specified, remove that symbol for the rest of the parsing
 		callSymbols = CallSymbols[1:]
 	}
-	name := ast.ProgramName{Name: callSymbols[0].(symbols.ProgramName).Name}
-	expressionsSymbols := callSymbols[1:]
+	if len(callSymbols) == 0 {
+		return ast.Call{}, newParseError(pos, CommandError, "call needs a program name")
+	}
+	nameSymbol, ok := callSymbols[0].(symbols.ProgramName)
+	if !ok {
+		return ast.Call{}, newParseError(symbols.PositionOf(callSymbols[0]), CommandError, "call expects a program name")
+	}
+	name := ast.ProgramName{Name: nameSymbol.Name, Pos: nameSymbol.Pos}
+	// each argument is one operand, so an argument using operators has to be in parentheses
+	parser := &expressionParser{expressionSymbols: callSymbols[1:]}
 	expressions := make([]ast.Expression, 0)
-	if len(expressionsSymbols) > 0 {
-		for _, symbol := range expressionsSymbols {
-			expression, err := parseSingleSymbolExpression(symbol)
-			if err != nil {
-				log.Fatal(err)
-			}
-			expressions = append(expressions, expression)
+	for !parser.isDone() {
+		if operator, ok := parser.expressionSymbols[parser.index].(symbols.BinaryOperator); ok {
+			return ast.Call{}, newParseError(operator.Pos, ExpressionError, "call arguments are separated by spaces, put an argument using operators in parentheses")
+		}
+		expression, err := parser.parseOperand(pos)
+		if err != nil {
+			return ast.Call{}, err
 		}
+		expressions = append(expressions, expression)
 	}
 
-	return ast.Call{Name: name, Expressions: expressions, ReturnTarget: ast.VariableName{Name: returnTargetName.Name}, HasReturnTarget: hasReturnTarget, Indent: indent}
+	return ast.Call{Name: name, Expressions: expressions, ReturnTarget: ast.VariableName{Name: returnTargetName.Name, Pos: returnTargetName.Pos}, HasReturnTarget: hasReturnTarget, Indent: indent, Pos: pos}, nil
 }
 
-func parseReturn(ReturnSymbols []symbols.Symbol, indent int) ast.Return {
+func parseReturn(ReturnSymbols []symbols.Symbol, indent int, pos symbols.Position) (ast.Return, error) {
 	hasExpression := len(ReturnSymbols) != 0
 	expr := ast.Expression(nil)
 	if hasExpression {
-		_expr, err := parseExpression(ReturnSymbols)
+		_expr, err := ParseExpression(ReturnSymbols, pos)
 		if err != nil {
-			log.Fatal(err)
+			return ast.Return{}, err
 		}
 		expr = _expr
 	}
-	return ast.Return{Expression: expr, HasExpression: hasExpression, Indent: indent}
+	return ast.Return{Expression: expr, HasExpression: hasExpression, Indent: indent, Pos: pos}, nil
+}
+
+func parseBreak(BreakSymbols []symbols.Symbol, indent int, pos symbols.Position) (ast.Break, error) {
+	if len(BreakSymbols) != 0 {
+		return ast.Break{}, newParseError(symbols.PositionOf(BreakSymbols[0]), CommandError, "break does not take any arguments")
+	}
+	return ast.Break{Indent: indent, Pos: pos}, nil
+}
+
+func parseContinue(ContinueSymbols []symbols.Symbol, indent int, pos symbols.Position) (ast.Continue, error) {
+	if len(ContinueSymbols) != 0 {
+		return ast.Continue{}, newParseError(symbols.PositionOf(ContinueSymbols[0]), CommandError, "continue does not take any arguments")
+	}
+	return ast.Continue{Indent: indent, Pos: pos}, nil
+}
+
+func parseImport(ImportSymbols []symbols.Symbol, indent int, pos symbols.Position) (ast.Import, error) {
+	if len(ImportSymbols) != 1 {
+		return ast.Import{}, newParseError(pos, CommandError, "import needs exactly one string literal, the path of the module")
+	}
+	path, ok := ImportSymbols[0].(symbols.StringLiteral)
+	if !ok {
+		return ast.Import{}, newParseError(symbols.PositionOf(ImportSymbols[0]), CommandError, "the path given to import must be a string literal")
+	}
+	return ast.Import{Path: path.Value, Indent: indent, Pos: pos}, nil
+}
+
+// parseAssert parses a condition, then an optional message. The message is one
+// operand like a call argument, so a message using operators has to be in parentheses
+func parseAssert(AssertSymbols []symbols.Symbol, indent int, pos symbols.Position) (ast.Assert, error) {
+	if len(AssertSymbols) == 0 {
+		return ast.Assert{}, newParseError(pos, CommandError, "assert needs a condition")
+	}
+	parser := &expressionParser{expressionSymbols: AssertSymbols, endsAtOperand: true}
+	cond, err := parser.parseBinaryOperators(0, pos)
+	if err != nil {
+		return ast.Assert{}, err
+	}
+	if parser.isDone() {
+		return ast.Assert{Cond: cond, Indent: indent, Pos: pos}, nil
+	}
+	if unmatched := parser.expressionSymbols[parser.index]; closingBracket(unmatched) != "" {
+		return ast.Assert{}, newParseError(symbols.PositionOf(unmatched), ExpressionError, "this "+closingBracket(unmatched)+" was never opened")
+	}
+
+	message, err := parser.parseOperand(pos)
+	if err != nil {
+		return ast.Assert{}, err
+	}
+	if !parser.isDone() {
+		return ast.Assert{}, newParseError(symbols.PositionOf(parser.expressionSymbols[parser.index]), CommandError, "assert takes a condition and one message, put a message using operators in parentheses")
+	}
+	return ast.Assert{Cond: cond, Message: message, HasMessage: true, Indent: indent, Pos: pos}, nil
 }
 
 func parseCommand(commandSymbols []symbols.Symbol) (ast.Command, bool, error) {
 	indent := commandSymbols[0].(symbols.Indent).Level
+	pos := symbols.PositionOf(commandSymbols[1])
 	switch commandSymbols[1].(type) {
 	case symbols.Print:
-		return parseLog(commandSymbols[2:], indent), false, nil
+		command, err := parseLog(commandSymbols[2:], indent, pos)
+		return command, false, err
 	case symbols.Read:
-		return parseRead(commandSymbols[2:], indent), false, nil
+		command, err := parseRead(commandSymbols[2:], indent, pos)
+		return command, false, err
 	case symbols.Assign:
-		return parseAssign(commandSymbols[2:], indent), false, nil
+		command, err := parseAssign(commandSymbols[2:], indent, pos)
+		return command, false, err
 	case symbols.Define:
-		return parseNew(commandSymbols[2:], indent), false, nil
+		command, err := parseNew(commandSymbols[2:], indent, pos)
+		return command, false, err
 	case symbols.If:
-		return parseIf(commandSymbols[2:], indent), true, nil
+		command, err := parseIf(commandSymbols[2:], indent, pos)
+		return command, true, err
+	case symbols.ElseIf:
+		command, err := parseElseIf(commandSymbols[2:], indent, pos)
+		return command, true, err
+	case symbols.Else:
+		command, err := parseElse(commandSymbols[2:], indent, pos)
+		return command, true, err
 	case symbols.While:
-		return parseWhile(commandSymbols[2:], indent), true, nil
+		command, err := parseWhile(commandSymbols[2:], indent, pos)
+		return command, true, err
 	case symbols.Program:
-		return parseProgram(commandSymbols[2:], indent), true, nil
+		command, err := parseProgram(commandSymbols[2:], indent, pos)
+		return command, true, err
 	case symbols.Call:
-		return parseCall(commandSymbols[2:], indent), false, nil
+		command, err := parseCall(commandSymbols[2:], indent, pos)
+		return command, false, err
 	case symbols.Return:
-		return parseReturn(commandSymbols[2:], indent), false, nil
+		command, err := parseReturn(commandSymbols[2:], indent, pos)
+		return command, false, err
+	case symbols.Break:
+		command, err := parseBreak(commandSymbols[2:], indent, pos)
+		return command, false, err
+	case symbols.Continue:
+		command, err := parseContinue(commandSymbols[2:], indent, pos)
+		return command, false, err
+	case symbols.Import:
+		command, err := parseImport(commandSymbols[2:], indent, pos)
+		return command, false, err
+	case symbols.Assert:
+		command, err := parseAssert(commandSymbols[2:], indent, pos)
+		return command, false, err
 	}
-	return nil, false, errors.New("the first symbol in the command is not recognized")
+	return nil, false, newParseError(pos, CommandError, "the first symbol in the command is not recognized")
 }
 
 func setCommandsInBlockCommand(command ast.Command, commands []ast.Command) (ast.Command, error) {
@@ -255,6 +439,12 @@ func setCommandsInBlockCommand(command ast.Command, commands []ast.Command) (ast
 	case ast.If:
 		blockCommand.Commands = commands
 		return blockCommand, nil
+	case ast.ElseIf:
+		blockCommand.Commands = commands
+		return blockCommand, nil
+	case ast.Else:
+		blockCommand.Commands = commands
+		return blockCommand, nil
 	case ast.While:
 		blockCommand.Commands = commands
 		return blockCommand, nil
@@ -263,20 +453,44 @@ func setCommandsInBlockCommand(command ast.Command, commands []ast.Command) (ast
 		return blockCommand, nil
 	}
 
-	return nil, errors.New("tried to set commands on a non block command")
+	return nil, newParseError(ast.PositionOf(command), CommandError, "tried to set commands on a non block command")
+}
+
+// attachToIf adds an elif or else command to the if command before it
+func attachToIf(ifCommand ast.If, command ast.Command) (ast.If, error) {
+	if ifCommand.HasElse {
+		return ast.If{}, newParseError(ast.PositionOf(command), CommandError, "nothing can follow the else of an if")
+	}
+	switch command := command.(type) {
+	case ast.ElseIf:
+		ifCommand.ElseIfs = append(ifCommand.ElseIfs, command)
+	case ast.Else:
+		ifCommand.Else = command
+		ifCommand.HasElse = true
+	}
+	return ifCommand, nil
 }
 
 // ParseBlock
 // Parse a single Block entirely.
 // Sub blocks will be recursively parsed then assigned into the
 // command they are related to within the outer block
-func ParseBlock(program [][]symbols.Symbol, expectedIndentation int) ([]ast.Command, int) {
+// A command that fails to parse is skipped (along with its block) so that
+// every ParseError in the program is returned together
+func ParseBlock(program [][]symbols.Symbol, expectedIndentation int) ([]ast.Command, int, error) {
 	commands := make([]ast.Command, 0)
 
+	if len(program) == 0 {
+		return commands, 0, nil
+	}
+
 	if program[0][0].(symbols.Indent).Level != expectedIndentation {
-		log.Fatal("First command in block is not indented properly, expected: " + fmt.Sprint(expectedIndentation) + " got: " + fmt.Sprint(program[0][0].(symbols.Indent).Level))
+		return nil, 0, newParseError(program[0][0].(symbols.Indent).Pos, IndentationError, "First command in block is not indented properly, expected: "+fmt.Sprint(expectedIndentation)+" got: "+fmt.Sprint(program[0][0].(symbols.Indent).Level))
 	}
 
+	parseErrors := make([]error, 0)
+	previousCommandParsed := true
+
 	// Track how many commands were parsed, so the parent block can skip over them
 	parsed := 0
 
@@ -291,32 +505,65 @@ func ParseBlock(program [][]symbols.Symbol, expectedIndentation int) ([]ast.Comm
 		thisIndent := commandSymbols[0].(symbols.Indent).Level
 
 		if thisIndent > expectedIndentation {
-			log.Fatal("The indentation unexpectedly increased")
+			parseErrors = append(parseErrors, newParseError(commandSymbols[0].(symbols.Indent).Pos, IndentationError, "The indentation unexpectedly increased"))
+			previousCommandParsed = false
+			parsed++
+			continue
 		} else if thisIndent < expectedIndentation {
 			// We are done parsing this block early because it un-indented
-			return commands, parsed
+			return commands, parsed, errors.Join(parseErrors...)
 		}
 
 		command, commandExpectsBlock, err := parseCommand(commandSymbols)
 		if err != nil {
-			log.Fatal(err)
+			parseErrors = append(parseErrors, err)
 		}
 		if commandExpectsBlock {
-			nextIndent := program[index+1][0].(symbols.Indent).Level
-			if nextIndent > thisIndent {
-				blockCommands, parsed := ParseBlock(program[index+1:], nextIndent)
-				skip = parsed // skip the number of commands parsed by the recursive call
-				command, err = setCommandsInBlockCommand(command, blockCommands)
+			if index+1 < len(program) && program[index+1][0].(symbols.Indent).Level > thisIndent {
+				nextIndent := program[index+1][0].(symbols.Indent).Level
+				blockCommands, blockParsed, blockErr := ParseBlock(program[index+1:], nextIndent)
+				skip = blockParsed // skip the number of commands parsed by the recursive call
+				if blockErr != nil {
+					parseErrors = append(parseErrors, blockErr)
+				}
+				if err == nil {
+					command, err = setCommandsInBlockCommand(command, blockCommands)
+					if err != nil {
+						parseErrors = append(parseErrors, err)
+					}
+				}
+			} else if err == nil {
+				err = newParseError(ast.PositionOf(command), MissingBlockError, "The next command after a block command was not indented")
+				parseErrors = append(parseErrors, err)
+			}
+		}
+		if err == nil {
+			switch command.(type) {
+			case ast.ElseIf, ast.Else:
+				// elif and else belong to the if command immediately before them
+				previousIf, isAfterIf := ast.If{}, false
+				if len(commands) > 0 && previousCommandParsed {
+					previousIf, isAfterIf = commands[len(commands)-1].(ast.If)
+				}
+				if isAfterIf {
+					command, err = attachToIf(previousIf, command)
+					if err == nil {
+						commands[len(commands)-1] = command
+					}
+				} else if previousCommandParsed {
+					err = newParseError(ast.PositionOf(command), CommandError, "elif and else must follow an if at the same indentation")
+				}
 				if err != nil {
-					log.Fatal(err)
+					parseErrors = append(parseErrors, err)
 				}
-			} else {
-				log.Fatal("The next command after a block command was not indented")
+			default:
+				commands = append(commands, command)
 			}
 		}
-		commands = append(commands, command)
+		// an elif or else after a command that failed to parse would only add a confusing second error
+		previousCommandParsed = err == nil
 		parsed++
 	}
 
-	return commands, parsed
+	return commands, parsed, errors.Join(parseErrors...)
 }
@@ -0,0 +1,187 @@
+package profile
+
+import (
+	"compress/gzip"
+	"io"
+	"morklerork/executor"
+	"morklerork/symbols"
+)
+
+// A pprof profile is a gzipped protocol buffer, described by
+// https://github.com/google/pprof/blob/main/proto/profile.proto
+// Only the fields written here are encoded, by hand, as it is a small part of the format
+
+// the field numbers used from profile.proto
+const (
+	profileSampleType    = 1
+	profileSample        = 2
+	profileLocation      = 4
+	profileFunction      = 5
+	profileStringTable   = 6
+	profileDurationNanos = 10
+
+	valueTypeType = 1
+	valueTypeUnit = 2
+
+	sampleLocationID = 1
+	sampleValue      = 2
+
+	locationID   = 1
+	locationLine = 4
+
+	lineFunctionID = 1
+	lineLine       = 2
+
+	functionID        = 1
+	functionName      = 2
+	functionFilename  = 4
+	functionStartLine = 5
+)
+
+// protoBuffer builds an encoded protocol buffer message
+type protoBuffer struct {
+	bytes []byte
+}
+
+func (buffer *protoBuffer) varint(value uint64) {
+	for value >= 0x80 {
+		buffer.bytes = append(buffer.bytes, byte(value)|0x80)
+		value >>= 7
+	}
+	buffer.bytes = append(buffer.bytes, byte(value))
+}
+
+// uint writes a varint field, zero values are left out as they are the default
+func (buffer *protoBuffer) uint(field int, value uint64) {
+	if value == 0 {
+		return
+	}
+	buffer.varint(uint64(field) << 3)
+	buffer.varint(value)
+}
+
+// message writes a length delimited field, which holds a message, string or packed numbers
+func (buffer *protoBuffer) message(field int, message []byte) {
+	buffer.varint(uint64(field)<<3 | 2)
+	buffer.varint(uint64(len(message)))
+	buffer.bytes = append(buffer.bytes, message...)
+}
+
+func (buffer *protoBuffer) packed(field int, values []uint64) {
+	var packed protoBuffer
+	for _, value := range values {
+		packed.varint(value)
+	}
+	buffer.message(field, packed.bytes)
+}
+
+// function is a program, in the file a location in it is
+type function struct {
+	name string
+	file string
+}
+
+// location is a line in a program
+type location struct {
+	function function
+	line     int
+}
+
+// pprofWriter gives every string, function and location an id as they are first used
+type pprofWriter struct {
+	profile   protoBuffer
+	strings   map[string]uint64
+	functions map[function]uint64
+	locations map[location]uint64
+}
+
+func (writer *pprofWriter) string(text string) uint64 {
+	if id, ok := writer.strings[text]; ok {
+		return id
+	}
+	id := uint64(len(writer.strings))
+	writer.strings[text] = id
+	writer.profile.message(profileStringTable, []byte(text))
+	return id
+}
+
+func (writer *pprofWriter) function(function function, startLine int) uint64 {
+	if id, ok := writer.functions[function]; ok {
+		return id
+	}
+	id := uint64(len(writer.functions) + 1)
+	writer.functions[function] = id
+	var message protoBuffer
+	message.uint(functionID, id)
+	message.uint(functionName, writer.string(function.name))
+	message.uint(functionFilename, writer.string(function.file))
+	message.uint(functionStartLine, uint64(startLine))
+	writer.profile.message(profileFunction, message.bytes)
+	return id
+}
+
+func (writer *pprofWriter) location(frame executor.ProfileFrame, pos symbols.Position) uint64 {
+	location := location{function: function{name: frame.Program, file: pos.File}, line: pos.Line}
+	if id, ok := writer.locations[location]; ok {
+		return id
+	}
+	functionID := writer.function(location.function, frame.ProgramPos.Line)
+	id := uint64(len(writer.locations) + 1)
+	writer.locations[location] = id
+	var line protoBuffer
+	line.uint(lineFunctionID, functionID)
+	line.uint(lineLine, uint64(location.line))
+	var message protoBuffer
+	message.uint(locationID, id)
+	message.message(locationLine, line.bytes)
+	writer.profile.message(profileLocation, message.bytes)
+	return id
+}
+
+func (writer *pprofWriter) valueType(kind string, unit string) {
+	var message protoBuffer
+	message.uint(valueTypeType, writer.string(kind))
+	message.uint(valueTypeUnit, writer.string(unit))
+	writer.profile.message(profileSampleType, message.bytes)
+}
+
+// WritePprof writes a Profile in the format `go tool pprof` reads. Each
+// sample is a chain of calls, with how many times the last program was
+// called from there and the nanoseconds it ran for itself. A program is
+// placed at the line it called the next program in the chain from, or at
+// the line it was created on if it is the last
+func WritePprof(profile *executor.Profile, stdout io.Writer) error {
+	writer := &pprofWriter{
+		strings:   make(map[string]uint64),
+		functions: make(map[function]uint64),
+		locations: make(map[location]uint64),
+	}
+	// the first string must be empty
+	writer.string("")
+	writer.valueType("calls", "count")
+	writer.valueType("time", "nanoseconds")
+
+	for _, stack := range profile.Stacks() {
+		frames := stack.Frames
+		// pprof lists the locations of a sample innermost first
+		locations := make([]uint64, 0, len(frames))
+		for i := len(frames) - 1; i >= 0; i-- {
+			pos := frames[i].ProgramPos
+			if i < len(frames)-1 {
+				pos = frames[i+1].CallPos
+			}
+			locations = append(locations, writer.location(frames[i], pos))
+		}
+		var sample protoBuffer
+		sample.packed(sampleLocationID, locations)
+		sample.packed(sampleValue, []uint64{uint64(stack.Calls), uint64(stack.Self.Nanoseconds())})
+		writer.profile.message(profileSample, sample.bytes)
+	}
+	writer.profile.uint(profileDurationNanos, uint64(topLevelTime(profile).Nanoseconds()))
+
+	compressed := gzip.NewWriter(stdout)
+	if _, err := compressed.Write(writer.profile.bytes); err != nil {
+		return err
+	}
+	return compressed.Close()
+}
@@ -0,0 +1,107 @@
+package profile
+
+import (
+	"fmt"
+	"io"
+	"morklerork/executor"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// WriteFile writes a Profile to fileName, in the format its name ends with.
+// A name ending .pb.gz is a pprof profile, .folded is folded stacks, and
+// anything else is the report from WriteReport
+func WriteFile(profile *executor.Profile, fileName string) error {
+	file, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	switch {
+	case strings.HasSuffix(fileName, ".pb.gz"):
+		err = WritePprof(profile, file)
+	case strings.HasSuffix(fileName, ".folded"):
+		err = WriteFolded(profile, file)
+	default:
+		err = WriteReport(profile, file)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// WriteReport writes a table of the programs that were called, the one that
+// ran longest in total first, then how many times each command ran, the
+// most run first
+func WriteReport(profile *executor.Profile, stdout io.Writer) error {
+	programs := profile.Programs()
+	total := topLevelTime(profile)
+
+	fmt.Fprintf(stdout, "ran for %s\n\n", round(total))
+	fmt.Fprintf(stdout, "%10s %12s %7s %12s %7s  %s\n", "calls", "total", "", "self", "", "program")
+	for _, program := range programs {
+		name := program.Name
+		if program.Pos.File != "" {
+			name += " (" + program.Pos.String() + ")"
+		}
+		fmt.Fprintf(stdout, "%10d %12s %7s %12s %7s  %s\n", program.Calls, round(program.Total), share(program.Total, total), round(program.Self), share(program.Self, total), name)
+	}
+
+	fmt.Fprintf(stdout, "\n%10s  %s\n", "hits", "command")
+	for _, line := range profile.Lines() {
+		fmt.Fprintf(stdout, "%10d  %s\n", line.Hits, line.Pos)
+	}
+	return nil
+}
+
+// topLevelTime is how long every run took, altogether
+func topLevelTime(profile *executor.Profile) time.Duration {
+	for _, program := range profile.Programs() {
+		if program.Name == executor.TopLevel {
+			return program.Total
+		}
+	}
+	return 0
+}
+
+// round drops the nanoseconds a report does not need
+func round(duration time.Duration) time.Duration {
+	return duration.Round(time.Microsecond)
+}
+
+// share is part as a percentage of whole
+func share(part time.Duration, whole time.Duration) string {
+	if whole == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", 100*float64(part)/float64(whole))
+}
+
+// WriteFolded writes one line for each chain of programs that was running,
+// their names separated by ; then the nanoseconds spent in the last of them.
+// This is the format flamegraph.pl, speedscope and inferno read
+func WriteFolded(profile *executor.Profile, stdout io.Writer) error {
+	// stacks that only differ by where calls were made are the same to a flamegraph
+	times := make(map[string]time.Duration)
+	for _, stack := range profile.Stacks() {
+		names := make([]string, 0, len(stack.Frames))
+		for _, frame := range stack.Frames {
+			names = append(names, frame.Program)
+		}
+		times[strings.Join(names, ";")] += stack.Self
+	}
+
+	stacks := make([]string, 0, len(times))
+	for stack := range times {
+		stacks = append(stacks, stack)
+	}
+	sort.Strings(stacks)
+	for _, stack := range stacks {
+		if times[stack] > 0 {
+			fmt.Fprintf(stdout, "%s %d\n", stack, times[stack].Nanoseconds())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,222 @@
+package profile
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"morklerork/executor"
+	"morklerork/lexer"
+	"morklerork/parser"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const source = `program $inner :n
+    new :i 0
+    while :i < :n
+        = :i :i + 1
+
+program $outer
+    call $inner 50
+    call $inner 50
+
+call $outer
+call $inner 10
+`
+
+func profiled(t *testing.T) *executor.Profile {
+	t.Helper()
+	fileSymbols, err := lexer.Lex("test.mr", source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commands, _, err := parser.ParseBlock(fileSymbols, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	profile := executor.NewProfile()
+	var output bytes.Buffer
+	interpreter := executor.NewInterpreter(strings.NewReader(""), &output, executor.DefaultHeapSize, executor.Options{Profile: profile})
+	if err := interpreter.Execute(commands); err != nil {
+		t.Fatal(err)
+	}
+	return profile
+}
+
+func TestWriteFolded(t *testing.T) {
+	profile := profiled(t)
+	var output bytes.Buffer
+	if err := WriteFolded(profile, &output); err != nil {
+		t.Fatal(err)
+	}
+
+	// the two calls of $inner from $outer are one stack in a flame graph
+	expected := make(map[string]int64)
+	for _, stack := range profile.Stacks() {
+		names := make([]string, 0, len(stack.Frames))
+		for _, frame := range stack.Frames {
+			names = append(names, frame.Program)
+		}
+		expected[strings.Join(names, ";")] += stack.Self.Nanoseconds()
+	}
+	lines := strings.Split(strings.TrimSuffix(output.String(), "\n"), "\n")
+	stacks := make([]string, 0, len(lines))
+	for _, line := range lines {
+		separator := strings.LastIndex(line, " ")
+		nanoseconds, err := strconv.ParseInt(line[separator+1:], 10, 64)
+		if separator < 0 || err != nil {
+			t.Fatalf("expected a stack then nanoseconds, got %q", line)
+		}
+		stack := line[:separator]
+		stacks = append(stacks, stack)
+		if nanoseconds != expected[stack] || nanoseconds <= 0 {
+			t.Errorf("expected %s to have run for %dns, got %d", stack, expected[stack], nanoseconds)
+		}
+	}
+	names := strings.Join(stacks, "\n")
+	if names != "(top level)\n(top level);$inner\n(top level);$outer\n(top level);$outer;$inner" {
+		t.Errorf("unexpected stacks, in sorted order:\n%s", names)
+	}
+}
+
+// field is one field of an encoded protocol buffer message
+type field struct {
+	number int
+	varint uint64
+	bytes  []byte
+}
+
+func readVarint(data []byte) (uint64, []byte, error) {
+	var value uint64
+	for shift := 0; shift < 64; shift += 7 {
+		if len(data) == 0 {
+			return 0, nil, errors.New("the message ends inside a varint")
+		}
+		value |= uint64(data[0]&0x7f) << shift
+		if data[0] < 0x80 {
+			return value, data[1:], nil
+		}
+		data = data[1:]
+	}
+	return 0, nil, errors.New("a varint is too long")
+}
+
+// readFields decodes a message that only uses varint and length delimited fields, as WritePprof does
+func readFields(data []byte) ([]field, error) {
+	fields := make([]field, 0)
+	for len(data) > 0 {
+		key, rest, err := readVarint(data)
+		if err != nil {
+			return nil, err
+		}
+		value, rest, err := readVarint(rest)
+		if err != nil {
+			return nil, err
+		}
+		read := field{number: int(key >> 3)}
+		switch key & 7 {
+		case 0:
+			read.varint = value
+		case 2:
+			if value > uint64(len(rest)) {
+				return nil, errors.New("a field is longer than the message")
+			}
+			read.bytes, rest = rest[:value], rest[value:]
+		default:
+			return nil, errors.New("unexpected wire type " + strconv.Itoa(int(key&7)))
+		}
+		fields = append(fields, read)
+		data = rest
+	}
+	return fields, nil
+}
+
+func TestWritePprof(t *testing.T) {
+	profile := profiled(t)
+	var output bytes.Buffer
+	if err := WritePprof(profile, &output); err != nil {
+		t.Fatal(err)
+	}
+	compressed, err := gzip.NewReader(&output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := io.ReadAll(compressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields, err := readFields(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	strs := make([]string, 0)
+	samples, locations, functions, sampleTypes := 0, 0, 0, 0
+	for _, field := range fields {
+		switch field.number {
+		case profileStringTable:
+			strs = append(strs, string(field.bytes))
+		case profileSample:
+			samples++
+			sample, err := readFields(field.bytes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the values are packed, a count of calls then nanoseconds
+			for _, part := range sample {
+				if part.number != sampleValue {
+					continue
+				}
+				calls, rest, err := readVarint(part.bytes)
+				if err != nil || calls == 0 {
+					t.Errorf("expected a sample to count its calls, got %d %v", calls, err)
+				}
+				if _, _, err := readVarint(rest); err != nil {
+					t.Error(err)
+				}
+			}
+		case profileLocation:
+			locations++
+		case profileFunction:
+			functions++
+		case profileSampleType:
+			sampleTypes++
+		}
+	}
+	if len(strs) == 0 || strs[0] != "" {
+		t.Errorf("expected the string table to start with the empty string, got %q", strs)
+	}
+	for _, expected := range []string{"calls", "count", "time", "nanoseconds", "$inner", "$outer", "(top level)", "test.mr"} {
+		if !contains(strs, expected) {
+			t.Errorf("expected %q in the string table, got %q", expected, strs)
+		}
+	}
+	// the top level can be in a file, where it calls a program, or in none
+	if sampleTypes != 2 || samples != len(profile.Stacks()) || functions < 3 || locations == 0 {
+		t.Errorf("expected 2 sample types, %d samples and a function for each program, got %d, %d and %d", len(profile.Stacks()), sampleTypes, samples, functions)
+	}
+}
+
+func contains(strs []string, str string) bool {
+	for _, candidate := range strs {
+		if candidate == str {
+			return true
+		}
+	}
+	return false
+}
+
+func TestWriteReport(t *testing.T) {
+	var output bytes.Buffer
+	if err := WriteReport(profiled(t), &output); err != nil {
+		t.Fatal(err)
+	}
+	report := output.String()
+	for _, expected := range []string{"ran for ", "(top level)", "$outer (test.mr:6:1)", "$inner (test.mr:1:1)", "hits  command", "110  test.mr:4:9"} {
+		if !strings.Contains(report, expected) {
+			t.Errorf("expected %q in the report:\n%s", expected, report)
+		}
+	}
+}
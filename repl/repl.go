@@ -0,0 +1,203 @@
+package repl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"morklerork/ast"
+	"morklerork/executor"
+	"morklerork/lexer"
+	"morklerork/loader"
+	"morklerork/parser"
+	"morklerork/symbols"
+	"strconv"
+	"strings"
+)
+
+// fileName is what errors in the repl's input are reported against, imports
+// are relative to the working directory as if it was a file there
+const fileName = "<repl>"
+
+const (
+	prompt             = "> "
+	continuationPrompt = "... "
+)
+
+type repl struct {
+	input       *bufio.Reader
+	stdout      io.Writer
+	interpreter *executor.Interpreter
+	session     *loader.Session
+}
+
+// Run reads MorkleRork from stdin a line at a time, executing every input
+// against one Interpreter so programs and variables persist between inputs.
+// A command that expects a block keeps reading lines until a blank line.
+// An input that is only an expression has its value printed.
+// `read` takes its input from the same stdin, Run returns once it is closed.
+// The Interpreter is made with heapSize and options, and each input is a run of its own for the limits
+func Run(stdin io.Reader, stdout io.Writer, heapSize int, options executor.Options) error {
+	input := bufio.NewReader(stdin)
+	repl := &repl{
+		input:       input,
+		stdout:      stdout,
+		interpreter: executor.NewInterpreter(input, stdout, heapSize, options),
+		session:     loader.NewSession(fileName),
+	}
+
+	for {
+		fmt.Fprint(stdout, prompt)
+		line, err := repl.readLine()
+		if err == io.EOF && line == "" {
+			fmt.Fprintln(stdout)
+			return nil
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if strings.HasPrefix(line, ".") {
+			repl.runMetaCommand(strings.Fields(line))
+			continue
+		}
+		repl.runInput(line)
+	}
+}
+
+func (repl *repl) readLine() (string, error) {
+	line, err := repl.input.ReadString('\n')
+	return strings.TrimRight(line, "\r\n"), err
+}
+
+// expectsBlock is true for the commands that have a block after them
+func expectsBlock(symbol symbols.Symbol) bool {
+	switch symbol.(type) {
+	case symbols.If, symbols.ElseIf, symbols.Else, symbols.While, symbols.Program:
+		return true
+	}
+	return false
+}
+
+func (repl *repl) printError(err error) {
+	fmt.Fprintln(repl.stdout, err)
+}
+
+func (repl *repl) runInput(line string) {
+	lineSymbols, err := lexer.Lex(fileName, line)
+	if err != nil {
+		repl.printError(err)
+		return
+	}
+	// a line with only a comment has no symbols at all
+	if len(lineSymbols) == 0 || len(lineSymbols[0]) < 2 {
+		return
+	}
+	firstSymbol := lineSymbols[0][1]
+
+	if !symbols.IsCommand(firstSymbol) {
+		repl.evaluate(lineSymbols[0][1:])
+		return
+	}
+
+	text := line
+	if expectsBlock(firstSymbol) {
+		// the block, and any elif or else after it, ends at a blank line
+		for {
+			fmt.Fprint(repl.stdout, continuationPrompt)
+			nextLine, err := repl.readLine()
+			if strings.TrimSpace(nextLine) == "" || err != nil {
+				text += "\n" + nextLine
+				break
+			}
+			text += "\n" + nextLine
+		}
+		lineSymbols, err = lexer.Lex(fileName, text)
+		if err != nil {
+			repl.printError(err)
+			return
+		}
+	}
+
+	commands, _, err := parser.ParseBlock(lineSymbols, 0)
+	if err != nil {
+		repl.printError(err)
+		return
+	}
+	program, err := repl.session.Add(commands)
+	if err != nil {
+		repl.printError(err)
+		return
+	}
+	if err := repl.interpreter.Execute(program); err != nil {
+		repl.printError(err)
+	}
+}
+
+func (repl *repl) evaluate(expressionSymbols []symbols.Symbol) {
+	expression, err := parser.ParseExpression(expressionSymbols, symbols.PositionOf(expressionSymbols[0]))
+	if err != nil {
+		repl.printError(err)
+		return
+	}
+	// the session only checks the names used, there is nothing to import
+	_, err = repl.session.Add([]ast.Command{ast.Return{Pos: ast.PositionOf(expression), Expression: expression, HasExpression: true}})
+	if err != nil {
+		repl.printError(err)
+		return
+	}
+	result, err := repl.interpreter.Evaluate(expression)
+	if err != nil {
+		repl.printError(err)
+		return
+	}
+	fmt.Fprintln(repl.stdout, result.Literal())
+}
+
+// runMetaCommand inspects the state of the Interpreter, without changing it
+func (repl *repl) runMetaCommand(fields []string) {
+	switch fields[0] {
+	case ".vars":
+		for _, variable := range repl.interpreter.Variables() {
+			fmt.Fprintln(repl.stdout, variable.Name+" = "+variable.Value.Literal())
+		}
+	case ".programs":
+		for _, program := range repl.interpreter.Programs() {
+			fmt.Fprintln(repl.stdout, strings.Join(append([]string{program.Name}, program.Parameters...), " "))
+		}
+	case ".heap":
+		repl.printHeap(fields[1:])
+	default:
+		fmt.Fprintln(repl.stdout, "unknown meta command "+fields[0]+", try .vars, .programs or .heap <first address> <last address>")
+	}
+}
+
+// printHeap prints the cells from the first address to the last, inclusive
+func (repl *repl) printHeap(arguments []string) {
+	usage := "usage: .heap <first address> <last address>"
+	if len(arguments) != 2 {
+		fmt.Fprintln(repl.stdout, usage)
+		return
+	}
+	first, err := strconv.Atoi(arguments[0])
+	if err != nil {
+		fmt.Fprintln(repl.stdout, usage)
+		return
+	}
+	last, err := strconv.Atoi(arguments[1])
+	if err != nil {
+		fmt.Fprintln(repl.stdout, usage)
+		return
+	}
+
+	for address := first; address <= last; address++ {
+		cell, err := repl.interpreter.HeapCell(address)
+		if err != nil {
+			repl.printError(err)
+			return
+		}
+		fmt.Fprintln(repl.stdout, strconv.Itoa(address)+": "+cell.Literal())
+	}
+}
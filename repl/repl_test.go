@@ -0,0 +1,42 @@
+package repl
+
+import (
+	"bytes"
+	"morklerork/executor"
+	"strings"
+	"testing"
+)
+
+func TestCommentOnlyLineKeepsSession(t *testing.T) {
+	var output bytes.Buffer
+	input := "new :x 1\n# note\n   \n# another note\nlog :x + 1\n"
+	if err := Run(strings.NewReader(input), &output, executor.DefaultHeapSize, executor.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(output.String(), "2") {
+		t.Errorf("expected the session to keep running after a comment, got %q", output.String())
+	}
+}
+
+func TestHeapSizeAndOptions(t *testing.T) {
+	var output bytes.Buffer
+	input := ".heap 0 3\n= [5] 1\n"
+	if err := Run(strings.NewReader(input), &output, 2, executor.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(output.String(), "the heap only has 2 cells") || strings.Contains(output.String(), "2: ") {
+		t.Errorf("expected the heap to have 2 cells, got %q", output.String())
+	}
+
+	output.Reset()
+	input = "= [5] 1\n[5]\nwhile ?true\n    new :x 1\n\nlog 'still running'\n"
+	if err := Run(strings.NewReader(input), &output, 2, executor.Options{GrowableHeap: true, MaxSteps: 100}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(output.String(), "> 1\n") {
+		t.Errorf("expected the growable heap to keep cell 5, got %q", output.String())
+	}
+	if !strings.Contains(output.String(), "MaxSteps") || !strings.Contains(output.String(), "still running") {
+		t.Errorf("expected MaxSteps to stop the loop and the session to carry on, got %q", output.String())
+	}
+}
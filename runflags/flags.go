@@ -0,0 +1,94 @@
+package runflags
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"morklerork/cover"
+	"morklerork/executor"
+	"morklerork/profile"
+	"os"
+	"time"
+)
+
+// Flags are the command line flags that change how programs run. They can be
+// given before a subcommand, and again after run, test and check-golden,
+// where they replace the ones given before
+type Flags struct {
+	TreeWalker   bool
+	MaxSteps     int
+	MaxCallDepth int
+	HeapSize     int
+	GrowableHeap bool
+	Timeout      time.Duration
+	Cover        bool
+	CoverFile    string
+	ProfileFile  string
+}
+
+// New creates Flags with the defaults the command line uses
+func New() *Flags {
+	return &Flags{HeapSize: executor.DefaultHeapSize}
+}
+
+// Register adds the flags to flagSet, each defaulting to its value in flags,
+// so the values parsed before a subcommand carry on into it
+func (flags *Flags) Register(flagSet *flag.FlagSet) {
+	flagSet.BoolVar(&flags.TreeWalker, "treewalker", flags.TreeWalker, "execute the ast directly, instead of compiling it to bytecode")
+	flagSet.IntVar(&flags.MaxSteps, "max-steps", flags.MaxSteps, "stop the program after it runs this many commands, 0 is no limit")
+	flagSet.IntVar(&flags.MaxCallDepth, "max-depth", flags.MaxCallDepth, "stop the program if more than this many programs are running at once, 0 is the default of 10000")
+	flagSet.IntVar(&flags.HeapSize, "heap", flags.HeapSize, "the number of cells in the heap")
+	flagSet.BoolVar(&flags.GrowableHeap, "growheap", flags.GrowableHeap, "let the program write past the end of the heap, growing it to fit")
+	flagSet.DurationVar(&flags.Timeout, "timeout", flags.Timeout, "stop the program after it runs for this long, such as 10s, 0 is no limit")
+	flagSet.BoolVar(&flags.Cover, "cover", flags.Cover, "record which commands run and which way conditions go, printing how much of each file ran")
+	flagSet.StringVar(&flags.CoverFile, "coverfile", flags.CoverFile, "write a listing of each file with how many times every line ran to this file, implies -cover")
+	flagSet.StringVar(&flags.ProfileFile, "profile", flags.ProfileFile, "time every call and write a profile to this file, as pprof if it ends .pb.gz, folded stacks if it ends .folded, and a report otherwise")
+}
+
+// Options checks the flags and makes the executor.Options they ask for,
+// with a new Coverage and Profile if they are wanted
+func (flags *Flags) Options() (executor.Options, error) {
+	if flags.HeapSize <= 0 {
+		return executor.Options{}, fmt.Errorf("-heap must be at least 1, not %d", flags.HeapSize)
+	}
+	options := executor.Options{
+		TreeWalker:   flags.TreeWalker,
+		GrowableHeap: flags.GrowableHeap,
+		MaxSteps:     flags.MaxSteps,
+		MaxCallDepth: flags.MaxCallDepth,
+		Timeout:      flags.Timeout,
+	}
+	if flags.Cover || flags.CoverFile != "" {
+		options.Coverage = executor.NewCoverage()
+	}
+	if flags.ProfileFile != "" {
+		options.Profile = executor.NewProfile()
+	}
+	return options, nil
+}
+
+// Report prints the coverage summary to summary, and writes the coverage
+// listing and profile files, for whatever options recorded
+func (flags *Flags) Report(options executor.Options, summary io.Writer) error {
+	var err error
+	if options.Coverage != nil {
+		cover.Summary(options.Coverage, summary)
+		if flags.CoverFile != "" {
+			err = writeListing(options.Coverage, flags.CoverFile)
+		}
+	}
+	if options.Profile != nil {
+		err = errors.Join(err, profile.WriteFile(options.Profile, flags.ProfileFile))
+	}
+	return err
+}
+
+func writeListing(coverage *executor.Coverage, fileName string) error {
+	listing, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer listing.Close()
+	return cover.WriteListing(coverage, listing)
+}
@@ -0,0 +1,40 @@
+package runflags
+
+import (
+	"flag"
+	"testing"
+)
+
+func TestFlagsAfterSubcommandKeepEarlierOnes(t *testing.T) {
+	runFlags := New()
+	before := flag.NewFlagSet("morklerork", flag.ContinueOnError)
+	runFlags.Register(before)
+	if err := before.Parse([]string{"-treewalker", "-heap", "50", "test", "-cover", "-heap", "70"}); err != nil {
+		t.Fatal(err)
+	}
+
+	after := flag.NewFlagSet("test", flag.ContinueOnError)
+	runFlags.Register(after)
+	if err := after.Parse(before.Args()[1:]); err != nil {
+		t.Fatal(err)
+	}
+	if !runFlags.TreeWalker || !runFlags.Cover || runFlags.HeapSize != 70 {
+		t.Errorf("expected -treewalker, -cover and -heap 70, got %+v", *runFlags)
+	}
+
+	options, err := runFlags.Options()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !options.TreeWalker || options.Coverage == nil {
+		t.Errorf("expected the options to use the tree walker and record coverage, got %+v", options)
+	}
+}
+
+func TestNonPositiveHeapIsRejected(t *testing.T) {
+	runFlags := New()
+	runFlags.HeapSize = -1
+	if _, err := runFlags.Options(); err == nil || err.Error() != "-heap must be at least 1, not -1" {
+		t.Errorf("expected the heap size to be rejected, got %v", err)
+	}
+}
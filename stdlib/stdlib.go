@@ -13,18 +13,31 @@ var stringLib string
 //go:embed input.mr
 var inputLib string
 
-func LoadStdLibFiles() string {
-	libNames := [3]string{
-		heapLib,
-		stringLib,
-		inputLib,
-	}
+// LibFile is one embedded standard library file
+// Name is what errors inside the file will be reported against
+type LibFile struct {
+	Name    string
+	Content string
+}
+
+var libFiles = map[string]LibFile{
+	"heap":   {Name: "stdlib/heap.mr", Content: heapLib},
+	"string": {Name: "stdlib/string.mr", Content: stringLib},
+	"input":  {Name: "stdlib/input.mr", Content: inputLib},
+}
 
-	libString := ""
+// Lookup finds the stdlib module imported as `import '<name>'`
+func Lookup(name string) (LibFile, bool) {
+	libFile, ok := libFiles[name]
+	return libFile, ok
+}
 
-	for _, fileContent := range libNames {
-		libString += "\n" + string(fileContent)
+// FileNamed finds the stdlib file positions in it are reported against, such as stdlib/heap.mr
+func FileNamed(fileName string) (LibFile, bool) {
+	for _, libFile := range libFiles {
+		if libFile.Name == fileName {
+			return libFile, true
+		}
 	}
-
-	return libString
+	return LibFile{}, false
 }
@@ -1,51 +1,83 @@
 package symbols
 
+import "fmt"
+
+// Position records where a Symbol was found in the original source files,
+// so that errors can be reported against the file the user actually wrote
+type Position struct {
+	File   string
+	Line   int
+	Column int
+}
+
+// String is file:line:column, or only the file for a position that is not
+// on a line, such as the one given to errors from Interpreter.Call
+func (position Position) String() string {
+	if position.Line == 0 {
+		return position.File
+	}
+	return fmt.Sprintf("%s:%d:%d", position.File, position.Line, position.Column)
+}
+
 // Since go lacks union types, a 'Symbol' can technically be anything
 // Its up to functions that receive Symbols to check they are one of the
 // correct types
 type Symbol interface{}
 
 type Indent struct {
+	Pos   Position
 	Level int
 }
 
-type Print struct{}
-type Read struct{}
-type Assign struct{}
-type Define struct{}
-type If struct{}
-type While struct{}
-type Program struct{}
-type Call struct{}
-type Return struct{}
+type Print struct{ Pos Position }
+type Read struct{ Pos Position }
+type Assign struct{ Pos Position }
+type Define struct{ Pos Position }
+type If struct{ Pos Position }
+type ElseIf struct{ Pos Position }
+type Else struct{ Pos Position }
+type While struct{ Pos Position }
+type Program struct{ Pos Position }
+type Call struct{ Pos Position }
+type Return struct{ Pos Position }
+type Break struct{ Pos Position }
+type Continue struct{ Pos Position }
+type Import struct{ Pos Position }
+type Assert struct{ Pos Position }
 
 type StringLiteral struct {
+	Pos   Position
 	Value string
 }
 
 type IntLiteral struct {
+	Pos   Position
 	Value int
 }
 
 type BooleanLiteral struct {
+	Pos   Position
 	Value bool
 }
 
 type VariableName struct {
+	Pos  Position
 	Name string
 }
 
 type ProgramName struct {
+	Pos  Position
 	Name string
 }
 
-type HeapAccess struct {
-	IndexExpressionSymbol Symbol
-}
+// Parentheses group part of an expression so it is evaluated first
+type OpenParenthesis struct{ Pos Position }
+type CloseParenthesis struct{ Pos Position }
+
+// Brackets surround the expression giving the address of a heap cell
+type OpenHeapAccess struct{ Pos Position }
+type CloseHeapAccess struct{ Pos Position }
 
-// By having a single 'BinaryOperator' Symbol with an enum type inside,
-// We can get precedence for free by using the numerical underpinning of
-// the enum as the precedence
 type BinaryOperatorType int
 
 const (
@@ -62,18 +94,103 @@ const (
 )
 
 var BinaryOperatorTypeNames = map[BinaryOperatorType]string{
-	0: "&",
-	1: "|",
-	2: "==",
-	3: "!=",
-	4: "<",
-	5: "+",
-	6: "-",
-	7: "*",
-	8: "/",
-	9: "%",
+	LogicalAndOperator: "&",
+	LogicalOrOperator:  "|",
+	EqualOperator:      "==",
+	NotEqualOperator:   "!=",
+	LTOperator:         "<",
+	PlusOperator:       "+",
+	MinusOperator:      "-",
+	DivideOperator:     "/",
+	TimesOperator:      "*",
+	ModuloOperator:     "%",
+}
+
+// BinaryOperatorPrecedence groups the operators into tiers, higher tiers are evaluated first
+// Operators in the same tier are evaluated left to right
+var BinaryOperatorPrecedence = map[BinaryOperatorType]int{
+	LogicalAndOperator: 0,
+	LogicalOrOperator:  1,
+	EqualOperator:      2,
+	NotEqualOperator:   2,
+	LTOperator:         3,
+	PlusOperator:       4,
+	MinusOperator:      4,
+	DivideOperator:     5,
+	TimesOperator:      5,
+	ModuloOperator:     5,
 }
 
 type BinaryOperator struct {
+	Pos                Position
 	BinaryOperatorType BinaryOperatorType
 }
+
+// IsCommand reports whether a Symbol is a CommandSymbol, the kind of Symbol a Command starts with
+func IsCommand(symbol Symbol) bool {
+	switch symbol.(type) {
+	case Print, Read, Assign, Define, If, ElseIf, Else, While, Program, Call, Return, Break, Continue, Import, Assert:
+		return true
+	}
+	return false
+}
+
+// PositionOf finds the Position of any Symbol, or the zero Position if
+// the Symbol is not one of the types above
+func PositionOf(symbol Symbol) Position {
+	switch symbol := symbol.(type) {
+	case Indent:
+		return symbol.Pos
+	case Print:
+		return symbol.Pos
+	case Read:
+		return symbol.Pos
+	case Assign:
+		return symbol.Pos
+	case Define:
+		return symbol.Pos
+	case If:
+		return symbol.Pos
+	case ElseIf:
+		return symbol.Pos
+	case Else:
+		return symbol.Pos
+	case While:
+		return symbol.Pos
+	case Program:
+		return symbol.Pos
+	case Call:
+		return symbol.Pos
+	case Return:
+		return symbol.Pos
+	case Break:
+		return symbol.Pos
+	case Continue:
+		return symbol.Pos
+	case Import:
+		return symbol.Pos
+	case Assert:
+		return symbol.Pos
+	case StringLiteral:
+		return symbol.Pos
+	case IntLiteral:
+		return symbol.Pos
+	case BooleanLiteral:
+		return symbol.Pos
+	case VariableName:
+		return symbol.Pos
+	case ProgramName:
+		return symbol.Pos
+	case OpenParenthesis:
+		return symbol.Pos
+	case CloseParenthesis:
+		return symbol.Pos
+	case OpenHeapAccess:
+		return symbol.Pos
+	case CloseHeapAccess:
+		return symbol.Pos
+	case BinaryOperator:
+		return symbol.Pos
+	}
+	return Position{}
+}
@@ -0,0 +1,195 @@
+package testrunner
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"morklerork/ast"
+	"morklerork/executor"
+	"morklerork/loader"
+	"morklerork/runflags"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// testPrefix starts the name of every program that is a test
+const testPrefix = "$test_"
+
+// testFileSuffix ends the name of every file tests are found in
+const testFileSuffix = "_test.mr"
+
+// result is what happened when one test ran
+type result struct {
+	program ast.Program
+	err     error
+	output  string
+}
+
+type runner struct {
+	stdout   io.Writer
+	heapSize int
+	options  executor.Options
+	filter   *regexp.Regexp
+	verbose  bool
+
+	passed int
+	failed int
+}
+
+// Run runs the tests in each file or directory named in arguments, or in the
+// current directory if none are. A test is a top level `program $test_<name>`
+// with no parameters, in a file ending with _test.mr. Each test runs in an
+// Interpreter of its own, which runs the top level of the file first, so no
+// test can see what another did. A test fails if it stops with an error,
+// such as a failed assert. The result of each file is printed to stdout, and
+// an error is returned if any test failed.
+// The flags from runFlags can be given too, they apply to every test, and
+// -cover and -profile add up what all of the tests ran
+func Run(arguments []string, stdout io.Writer, runFlags *runflags.Flags) error {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	run := flags.String("run", "", "only run the tests whose names match this regular expression")
+	verbose := flags.Bool("v", false, "print every test as it runs, and what it logs, even if it passes")
+	runFlags.Register(flags)
+	if err := flags.Parse(arguments); err != nil {
+		return err
+	}
+	filter, err := regexp.Compile(*run)
+	if err != nil {
+		return fmt.Errorf("-run: %w", err)
+	}
+	options, err := runFlags.Options()
+	if err != nil {
+		return err
+	}
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	files, err := testFiles(paths)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return errors.New("no " + testFileSuffix + " files found in " + strings.Join(paths, " "))
+	}
+
+	runner := &runner{stdout: stdout, heapSize: runFlags.HeapSize, options: options, filter: filter, verbose: *verbose}
+	for _, file := range files {
+		runner.runFile(file)
+	}
+	err = runFlags.Report(options, stdout)
+	if runner.failed > 0 {
+		return errors.Join(fmt.Errorf("%d of %d tests failed", runner.failed, runner.passed+runner.failed), err)
+	}
+	return err
+}
+
+// testFiles finds the test files in each path, a directory gives every
+// _test.mr file directly inside it, and a file is used as it is
+func testFiles(paths []string) ([]string, error) {
+	files := make([]string, 0)
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(path, "*"+testFileSuffix))
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(matches)
+		files = append(files, matches...)
+	}
+	return files, nil
+}
+
+// testPrograms lists the tests at the top level of a file, in the order they are written
+func testPrograms(commands []ast.Command) []ast.Program {
+	tests := make([]ast.Program, 0)
+	for _, command := range commands {
+		if program, ok := command.(ast.Program); ok && strings.HasPrefix(program.Name.Name, testPrefix) {
+			tests = append(tests, program)
+		}
+	}
+	return tests
+}
+
+func (runner *runner) runFile(file string) {
+	commands, err := loader.Load(file)
+	if err != nil {
+		runner.failed++
+		fmt.Fprintf(runner.stdout, "FAIL %s\n%s\n", file, indent(err.Error()))
+		return
+	}
+
+	passed, failed := 0, 0
+	for _, program := range testPrograms(commands) {
+		if !runner.filter.MatchString(program.Name.Name) {
+			continue
+		}
+		if runner.verbose {
+			fmt.Fprintf(runner.stdout, "=== RUN %s\n", program.Name.Name)
+		}
+		result := runner.runTest(commands, program)
+		if result.err == nil {
+			passed++
+		} else {
+			failed++
+		}
+		runner.report(result)
+	}
+	runner.passed += passed
+	runner.failed += failed
+
+	switch {
+	case failed > 0:
+		fmt.Fprintf(runner.stdout, "FAIL %s %d passed, %d failed\n", file, passed, failed)
+	case passed == 0:
+		fmt.Fprintf(runner.stdout, "ok   %s no tests to run\n", file)
+	default:
+		fmt.Fprintf(runner.stdout, "ok   %s %d passed\n", file, passed)
+	}
+}
+
+// runTest runs the top level of a file in a new Interpreter, then calls the test
+func (runner *runner) runTest(commands []ast.Command, program ast.Program) result {
+	if len(program.Parameters) != 0 {
+		return result{program: program, err: errors.New(program.Pos.String() + ": a test can not have parameters")}
+	}
+	var output bytes.Buffer
+	interpreter := executor.NewInterpreter(strings.NewReader(""), &output, runner.heapSize, runner.options)
+	err := interpreter.Execute(commands)
+	if err == nil {
+		// the test is called from where it is created, which is where its trace starts
+		call := ast.Call{Pos: program.Pos, Name: program.Name}
+		err = interpreter.Execute([]ast.Command{call})
+	}
+	return result{program: program, err: err, output: output.String()}
+}
+
+func (runner *runner) report(result result) {
+	name := result.program.Name.Name
+	if result.err != nil {
+		fmt.Fprintf(runner.stdout, "--- FAIL: %s (%s)\n%s\n", name, result.program.Pos, indent(result.err.Error()))
+	} else if runner.verbose {
+		fmt.Fprintf(runner.stdout, "--- PASS: %s (%s)\n", name, result.program.Pos)
+	}
+	if result.output != "" && (result.err != nil || runner.verbose) {
+		fmt.Fprintf(runner.stdout, "    logged:\n%s\n", indent(indent(strings.TrimSuffix(result.output, "\n"))))
+	}
+}
+
+// indent puts four spaces before every line of text
+func indent(text string) string {
+	return "    " + strings.ReplaceAll(text, "\n", "\n    ")
+}
@@ -0,0 +1,91 @@
+package testrunner
+
+import (
+	"bytes"
+	"morklerork/runflags"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// source is a test file whose tests would fail if the heap or globals were
+// kept from one test to the next. The top level runs again before every test,
+// so its new would fail if the globals were kept
+const source = `new :runs 0
+
+program $test_writes_heap
+    assert [0] == '' 'the heap starts empty'
+    = [0] 'written'
+
+program $test_heap_is_fresh
+    assert [0] == '' ('expected an empty cell, got ' + [0])
+
+program $test_fails
+    log 'about to fail'
+    assert 1 == 2 'one is not two'
+
+program $helper
+    log 'not a test'
+`
+
+func writeTests(t *testing.T) string {
+	t.Helper()
+	directory := t.TempDir()
+	if err := os.WriteFile(filepath.Join(directory, "example_test.mr"), []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// only files ending _test.mr are looked in
+	if err := os.WriteFile(filepath.Join(directory, "example.mr"), []byte("program $test_not_found\n    assert 1 == 2 'not a test file'\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return directory
+}
+
+func TestRun(t *testing.T) {
+	directory := writeTests(t)
+	var output bytes.Buffer
+	err := Run([]string{"-v", directory}, &output, runflags.New())
+	if err == nil || err.Error() != "1 of 3 tests failed" {
+		t.Errorf("expected 1 of 3 tests to fail, got %v", err)
+	}
+
+	file := filepath.Join(directory, "example_test.mr")
+	expected := []string{
+		"=== RUN $test_writes_heap",
+		"--- PASS: $test_writes_heap (" + file + ":3:1)",
+		"=== RUN $test_heap_is_fresh",
+		"--- PASS: $test_heap_is_fresh (" + file + ":7:1)",
+		"=== RUN $test_fails",
+		"--- FAIL: $test_fails (" + file + ":10:1)",
+		"    " + file + ":12:5: Assertion failed: one is not two",
+		"        in $test_fails, called at " + file + ":10:1",
+		"    logged:",
+		"        about to fail",
+		"FAIL " + file + " 2 passed, 1 failed",
+		"",
+	}
+	if output.String() != strings.Join(expected, "\n") {
+		t.Errorf("expected\n%s\ngot\n%s", strings.Join(expected, "\n"), output.String())
+	}
+}
+
+func TestRunFilter(t *testing.T) {
+	directory := writeTests(t)
+	var output bytes.Buffer
+	if err := Run([]string{"-run", "heap", directory}, &output, runflags.New()); err != nil {
+		t.Errorf("expected the tests matching heap to pass, got %v\n%s", err, output.String())
+	}
+	expected := "ok   " + filepath.Join(directory, "example_test.mr") + " 2 passed\n"
+	if output.String() != expected {
+		t.Errorf("expected %q, got %q", expected, output.String())
+	}
+}
+
+func TestRunWithoutTestFiles(t *testing.T) {
+	var output bytes.Buffer
+	err := Run([]string{t.TempDir()}, &output, runflags.New())
+	if err == nil || !strings.HasPrefix(err.Error(), "no _test.mr files found in") {
+		t.Errorf("expected no test files to be an error, got %v", err)
+	}
+}
@@ -0,0 +1,338 @@
+package vet
+
+import (
+	"errors"
+	"fmt"
+	"morklerork/ast"
+	"morklerork/executor"
+	"morklerork/symbols"
+)
+
+// unknown is the type of a value Check can not work out, such as a heap cell,
+// a parameter, or what a program returns
+const unknown executor.ResultType = -1
+
+// scope mirrors the executor's scopes, holding the type of each variable instead of its value
+type scope []map[string]executor.ResultType
+
+func (original scope) copy() scope {
+	copied := make(scope, 0, len(original))
+	for _, block := range original {
+		copiedBlock := make(map[string]executor.ResultType, len(block))
+		for name, resultType := range block {
+			copiedBlock[name] = resultType
+		}
+		copied = append(copied, copiedBlock)
+	}
+	return copied
+}
+
+type checker struct {
+	// every program in the whole program by name, a call can be checked
+	// against a program created later as long as it has been by the time it runs
+	programs map[string]ast.Program
+	// programs whose program command has been checked, at the top level
+	created map[string]bool
+	// the programs every Interpreter starts with, which no program command can replace
+	builtins map[string]bool
+
+	scope scope
+	// loops is how many while loops the command is in, inside the running program
+	loops       int
+	isInProgram bool
+	// quiet is set while a loop is checked the first time, to find the variables
+	// it changes the type of. The errors are found the second time
+	quiet bool
+
+	errors []error
+}
+
+// Check finds the mistakes in a program that would be RuntimeErrors, without
+// running it. Every mistake is returned together, even ones that would only
+// happen on some runs. program should come from loader.Load, so the programs
+// of every module are known
+func Check(program []ast.Command) error {
+	checker := &checker{
+		programs: make(map[string]ast.Program),
+		created:  make(map[string]bool),
+		builtins: make(map[string]bool),
+		scope:    scope{{}},
+	}
+	for _, builtin := range executor.BuiltinPrograms() {
+		builtinProgram := ast.Program{Name: ast.ProgramName{Name: builtin.Name}}
+		for _, parameter := range builtin.Parameters {
+			builtinProgram.Parameters = append(builtinProgram.Parameters, ast.VariableName{Name: parameter})
+		}
+		checker.programs[builtin.Name] = builtinProgram
+		checker.created[builtin.Name] = true
+		checker.builtins[builtin.Name] = true
+	}
+	checker.collectPrograms(program)
+	// the top level runs in the global scope, not a block of its own
+	for _, command := range program {
+		checker.checkCommand(command)
+	}
+	return errors.Join(checker.errors...)
+}
+
+func (checker *checker) report(pos symbols.Position, kind VetErrorKind, message string) {
+	if !checker.quiet {
+		checker.errors = append(checker.errors, newVetError(pos, kind, message))
+	}
+}
+
+func (checker *checker) collectPrograms(commands []ast.Command) {
+	for _, command := range commands {
+		switch command := command.(type) {
+		case ast.If:
+			checker.collectPrograms(command.Commands)
+			for _, elseIf := range command.ElseIfs {
+				checker.collectPrograms(elseIf.Commands)
+			}
+			checker.collectPrograms(command.Else.Commands)
+		case ast.While:
+			checker.collectPrograms(command.Commands)
+		case ast.Program:
+			checker.programs[command.Name.Name] = command
+			checker.collectPrograms(command.Commands)
+		}
+	}
+}
+
+func typeName(resultType executor.ResultType) string {
+	switch resultType {
+	case executor.Int:
+		return "int"
+	case executor.Bool:
+		return "bool"
+	}
+	return "string"
+}
+
+func (checker *checker) lookup(name string) (executor.ResultType, bool) {
+	for i := len(checker.scope) - 1; i >= 0; i-- {
+		if resultType, ok := checker.scope[i][name]; ok {
+			return resultType, true
+		}
+	}
+	return unknown, false
+}
+
+// forgetChanged sets every variable that any path through a block changed the
+// type of to unknown, as which path runs is not known until the program runs
+func (checker *checker) forgetChanged(before scope, paths []scope) {
+	for i, block := range before {
+		for name, resultType := range block {
+			for _, path := range paths {
+				if path[i][name] != resultType {
+					checker.scope[i][name] = unknown
+					break
+				}
+			}
+		}
+	}
+}
+
+func (checker *checker) checkBlock(commands []ast.Command) {
+	checker.scope = append(checker.scope, make(map[string]executor.ResultType))
+	for _, command := range commands {
+		checker.checkCommand(command)
+	}
+	checker.scope = checker.scope[:len(checker.scope)-1]
+}
+
+func (checker *checker) checkCommand(command ast.Command) {
+	switch command := command.(type) {
+	case ast.Log:
+		checker.checkExpression(command.Expr)
+	case ast.Read:
+		checker.checkTarget(command.Target, executor.String)
+	case ast.New:
+		resultType := checker.checkExpression(command.Expr)
+		if _, ok := checker.lookup(command.VariableName); ok {
+			checker.report(command.Pos, RedefinedVariableError, "VariableName "+command.VariableName+" is already defined in this scope")
+			return
+		}
+		checker.scope[len(checker.scope)-1][command.VariableName] = resultType
+	case ast.Assign:
+		checker.checkTarget(command.Target, checker.checkExpression(command.Expr))
+	case ast.If:
+		checker.checkIf(command)
+	case ast.While:
+		checker.checkWhile(command)
+	case ast.Program:
+		checker.checkProgram(command)
+	case ast.Call:
+		checker.checkCall(command)
+	case ast.Return:
+		if command.HasExpression {
+			checker.checkExpression(command.Expression)
+		}
+	case ast.Break:
+		if checker.loops == 0 {
+			checker.report(command.Pos, ControlFlowError, "break used outside of a while loop")
+		}
+	case ast.Continue:
+		if checker.loops == 0 {
+			checker.report(command.Pos, ControlFlowError, "continue used outside of a while loop")
+		}
+	case ast.Assert:
+		checker.checkCondition(command.Cond, command.Pos, "Assert")
+		if command.HasMessage {
+			checker.checkExpression(command.Message)
+		}
+	}
+}
+
+// checkTarget checks the Variable or HeapAccess a command writes a value of resultType to
+func (checker *checker) checkTarget(target ast.Expression, resultType executor.ResultType) {
+	switch target := target.(type) {
+	case ast.VariableName:
+		for i := len(checker.scope) - 1; i >= 0; i-- {
+			if _, ok := checker.scope[i][target.Name]; ok {
+				checker.scope[i][target.Name] = resultType
+				return
+			}
+		}
+		checker.report(target.Pos, UndefinedVariableError, "Could not find variable "+target.Name+" in scope. Declare it with new first")
+	case ast.HeapAccess:
+		checker.checkExpression(target)
+	}
+}
+
+func (checker *checker) checkCondition(condition ast.Expression, pos symbols.Position, commandName string) {
+	resultType := checker.checkExpression(condition)
+	if resultType != unknown && resultType != executor.Bool {
+		checker.report(pos, TypeError, commandName+" condition is always of type "+typeName(resultType)+", it must be a bool")
+	}
+}
+
+func (checker *checker) checkIf(ifCommand ast.If) {
+	checker.checkCondition(ifCommand.Cond, ifCommand.Pos, "If")
+	before := checker.scope.copy()
+	paths := make([]scope, 0)
+
+	checker.checkBlock(ifCommand.Commands)
+	paths = append(paths, checker.scope)
+	for _, elseIf := range ifCommand.ElseIfs {
+		checker.scope = before.copy()
+		checker.checkCondition(elseIf.Cond, elseIf.Pos, "Elif")
+		checker.checkBlock(elseIf.Commands)
+		paths = append(paths, checker.scope)
+	}
+	if ifCommand.HasElse {
+		checker.scope = before.copy()
+		checker.checkBlock(ifCommand.Else.Commands)
+		paths = append(paths, checker.scope)
+	}
+
+	checker.scope = before.copy()
+	checker.forgetChanged(before, paths)
+}
+
+func (checker *checker) checkWhile(whileCommand ast.While) {
+	checker.checkCondition(whileCommand.Cond, whileCommand.Pos, "While")
+
+	// a variable the body changes the type of could have either type at the
+	// start of the body, after the first time round
+	before := checker.scope.copy()
+	wasQuiet := checker.quiet
+	checker.quiet = true
+	checker.loops++
+	checker.checkBlock(whileCommand.Commands)
+	checker.quiet = wasQuiet
+	after := checker.scope
+	checker.scope = before.copy()
+	checker.forgetChanged(before, []scope{after})
+
+	before = checker.scope.copy()
+	checker.checkBlock(whileCommand.Commands)
+	checker.loops--
+	after = checker.scope
+	checker.scope = before.copy()
+	checker.forgetChanged(before, []scope{after})
+}
+
+// checkProgram checks the body of a program once, where it is created.
+// It can only see its parameters, whose types depend on each call
+func (checker *checker) checkProgram(program ast.Program) {
+	if checker.builtins[program.Name.Name] {
+		checker.report(program.Pos, RedefinedProgramError, "Program "+program.Name.Name+" is given by the host, a program command cannot replace it")
+	}
+	outerScope, outerLoops, wasInProgram := checker.scope, checker.loops, checker.isInProgram
+	parameters := make(map[string]executor.ResultType)
+	for _, parameter := range program.Parameters {
+		if _, ok := parameters[parameter.Name]; ok {
+			checker.report(parameter.Pos, RedefinedVariableError, "VariableName "+parameter.Name+" is already defined in this scope")
+		}
+		parameters[parameter.Name] = unknown
+	}
+	checker.scope, checker.loops, checker.isInProgram = scope{parameters}, 0, true
+	checker.checkBlock(program.Commands)
+	checker.scope, checker.loops, checker.isInProgram = outerScope, outerLoops, wasInProgram
+
+	if !checker.isInProgram {
+		checker.created[program.Name.Name] = true
+	}
+}
+
+func (checker *checker) checkCall(call ast.Call) {
+	for _, argument := range call.Expressions {
+		checker.checkExpression(argument)
+	}
+	if call.HasReturnTarget {
+		checker.checkTarget(call.ReturnTarget, unknown)
+	}
+
+	program, ok := checker.programs[call.Name.Name]
+	if !ok {
+		checker.report(call.Pos, UndefinedProgramError, "Tried to call "+call.Name.Name+" but no program command creates it")
+		return
+	}
+	// at the top level, outside of any loop, commands run in the order they are written
+	if !checker.isInProgram && checker.loops == 0 && !checker.created[call.Name.Name] {
+		checker.report(call.Pos, UndefinedProgramError, "Tried to call "+call.Name.Name+" before the program command that creates it")
+	}
+	if len(call.Expressions) != len(program.Parameters) {
+		checker.report(call.Pos, ArgumentCountError, fmt.Sprintf("Tried to call %s with %d arguments, but it expects %d parameters", call.Name.Name, len(call.Expressions), len(program.Parameters)))
+	}
+}
+
+// checkExpression works out the type of an expression, reporting any
+// mistakes in it. It is unknown if the type depends on what happens at runtime
+func (checker *checker) checkExpression(expression ast.Expression) executor.ResultType {
+	switch expression := expression.(type) {
+	case ast.StringLiteral:
+		return executor.String
+	case ast.IntLiteral:
+		return executor.Int
+	case ast.BooleanLiteral:
+		return executor.Bool
+	case ast.VariableName:
+		resultType, ok := checker.lookup(expression.Name)
+		if !ok {
+			checker.report(expression.Pos, UndefinedVariableError, "Could not find variable "+expression.Name+" in scope. Declare it with new first")
+		}
+		return resultType
+	case ast.HeapAccess:
+		addressType := checker.checkExpression(expression.IndexExpression)
+		if addressType != unknown && addressType != executor.Int {
+			checker.report(expression.Pos, TypeError, "tried to access the heap with a value of type "+typeName(addressType)+", it must be an int")
+		}
+		return unknown
+	case ast.BinaryOperator:
+		lhs := checker.checkExpression(expression.Lhs)
+		rhs := checker.checkExpression(expression.Rhs)
+		if lhs == unknown || rhs == unknown {
+			return unknown
+		}
+		resultType, err := executor.BinaryOperatorResultType(lhs, rhs, expression.BinaryOperatorType)
+		var runtimeErr *executor.RuntimeError
+		if errors.As(err, &runtimeErr) {
+			checker.report(expression.Pos, TypeError, runtimeErr.Message)
+			return unknown
+		}
+		return resultType
+	}
+	return unknown
+}
@@ -0,0 +1,167 @@
+package vet
+
+import (
+	"errors"
+	"morklerork/ast"
+	"morklerork/lexer"
+	"morklerork/parser"
+	"testing"
+)
+
+func parse(t *testing.T, source string) []ast.Command {
+	t.Helper()
+	fileSymbols, err := lexer.Lex("test.mr", source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commands, _, err := parser.ParseBlock(fileSymbols, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return commands
+}
+
+// vetErrors is every finding of Check, in the order they were found
+func vetErrors(t *testing.T, source string) []*VetError {
+	t.Helper()
+	err := Check(parse(t, source))
+	if err == nil {
+		return nil
+	}
+	errs := []error{err}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs = joined.Unwrap()
+	}
+	found := make([]*VetError, 0, len(errs))
+	for _, err := range errs {
+		var vetErr *VetError
+		if !errors.As(err, &vetErr) {
+			t.Fatalf("expected a VetError, got %v", err)
+		}
+		found = append(found, vetErr)
+	}
+	return found
+}
+
+func TestCheck(t *testing.T) {
+	type finding struct {
+		kind    VetErrorKind
+		message string
+	}
+	tests := []struct {
+		name     string
+		source   string
+		expected []finding
+	}{
+		{
+			name:   "an undefined program",
+			source: "call $nope 1\n",
+			expected: []finding{
+				{UndefinedProgramError, "test.mr:1:1: Tried to call $nope but no program command creates it"},
+			},
+		},
+		{
+			name:   "a call before the program is created",
+			source: "call $later\nprogram $later\n    log 1\n",
+			expected: []finding{
+				{UndefinedProgramError, "test.mr:1:1: Tried to call $later before the program command that creates it"},
+			},
+		},
+		{
+			name:   "the wrong number of arguments",
+			source: "program $f :a\n    return :a\ncall $f 1 2\n",
+			expected: []finding{
+				{ArgumentCountError, "test.mr:3:1: Tried to call $f with 2 arguments, but it expects 1 parameters"},
+			},
+		},
+		{
+			name:   "undeclared variables",
+			source: "= :x 1\nlog :y\nread :z\n",
+			expected: []finding{
+				{UndefinedVariableError, "test.mr:1:3: Could not find variable :x in scope. Declare it with new first"},
+				{UndefinedVariableError, "test.mr:2:5: Could not find variable :y in scope. Declare it with new first"},
+				{UndefinedVariableError, "test.mr:3:6: Could not find variable :z in scope. Declare it with new first"},
+			},
+		},
+		{
+			name:   "a global used in a program",
+			source: "new :x 1\nprogram $f\n    log :x\n",
+			expected: []finding{
+				{UndefinedVariableError, "test.mr:3:9: Could not find variable :x in scope. Declare it with new first"},
+			},
+		},
+		{
+			name:   "a variable declared twice",
+			source: "new :x 1\nnew :x 2\n",
+			expected: []finding{
+				{RedefinedVariableError, "test.mr:2:1: VariableName :x is already defined in this scope"},
+			},
+		},
+		{
+			name:   "a string minus an int",
+			source: "new :x 'a' - 1\n",
+			expected: []finding{
+				{TypeError, "test.mr:1:12: Cannot use - on string and int"},
+			},
+		},
+		{
+			name:   "conditions that are not bools",
+			source: "if 1\n    log 1\nwhile 'a'\n    log 1\n",
+			expected: []finding{
+				{TypeError, "test.mr:1:1: If condition is always of type int, it must be a bool"},
+				{TypeError, "test.mr:3:1: While condition is always of type string, it must be a bool"},
+			},
+		},
+		{
+			name:   "break outside of a loop",
+			source: "break\n",
+			expected: []finding{
+				{ControlFlowError, "test.mr:1:1: break used outside of a while loop"},
+			},
+		},
+		{
+			name:   "replacing a builtin",
+			source: "program $sys$heapSize\n    return 5\n",
+			expected: []finding{
+				{RedefinedProgramError, "test.mr:1:1: Program $sys$heapSize is given by the host, a program command cannot replace it"},
+			},
+		},
+		{
+			name: "a clean program",
+			source: `program $fib :n
+    if :n < 3
+        return 1
+    new :a 0
+    new :b 0
+    call :a $fib (:n - 1)
+    call :b $fib (:n - 2)
+    return :a + :b
+
+new :i 0
+new :result 0
+while :i < 10
+    = :i :i + 1
+    if :i % 2 == 0
+        continue
+    call :result $fib :i
+    log '' + :result + '\n'
+new :size 0
+call :size $sys$heapSize
+= [0] :size
+`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			found := vetErrors(t, test.source)
+			if len(found) != len(test.expected) {
+				t.Fatalf("expected %d findings, got %v", len(test.expected), found)
+			}
+			for i, expected := range test.expected {
+				if found[i].Kind != expected.kind || found[i].Error() != expected.message {
+					t.Errorf("expected %q of kind %d, got %q of kind %d", expected.message, expected.kind, found[i].Error(), found[i].Kind)
+				}
+			}
+		})
+	}
+}
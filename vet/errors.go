@@ -0,0 +1,32 @@
+package vet
+
+import "morklerork/symbols"
+
+// VetErrorKind is what went wrong in a VetError
+type VetErrorKind int
+
+const (
+	UndefinedProgramError VetErrorKind = iota
+	ArgumentCountError
+	UndefinedVariableError
+	RedefinedVariableError
+	TypeError
+	ControlFlowError
+	RedefinedProgramError
+)
+
+// VetError is a mistake Check found without running the program,
+// one that would be a RuntimeError if the command was reached
+type VetError struct {
+	Pos     symbols.Position
+	Kind    VetErrorKind
+	Message string
+}
+
+func (err *VetError) Error() string {
+	return err.Pos.String() + ": " + err.Message
+}
+
+func newVetError(pos symbols.Position, kind VetErrorKind, message string) *VetError {
+	return &VetError{Pos: pos, Kind: kind, Message: message}
+}